@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestParseCellProfiles(t *testing.T) {
+	defer func(doses []ifnDose) { ifnDoses = doses }(ifnDoses)
+	ifnDoses = nil
+	list := parseCellProfiles("vero:ifn=0,tau=0;mdbk:rho=0.1")
+	if len(list) != 2 || list[0].name != "vero" || list[1].name != "mdbk" {
+		t.Fatalf("parsed %+v", list)
+	}
+	if list[0].ifn != 0 || list[0].tau != 0 || list[0].rho != RHO {
+		t.Errorf("vero profile is %+v, want ifn 0, tau 0 and the global rho", list[0])
+	}
+	if list[1].rho != 0.1 || list[1].ifn != 1 || list[1].tau != TAU {
+		t.Errorf("mdbk profile is %+v, want rho 0.1 and the global ifn and tau", list[1])
+	}
+	if def := parseCellProfiles(""); len(def) != 1 || def[0].name != "default" {
+		t.Errorf("an empty spec gives %+v, want one default profile", def)
+	}
+}
+
+func TestAssignCellTypeLayouts(t *testing.T) {
+	defer func(profiles []cellProfile) { cellProfiles = profiles }(cellProfiles)
+	cellProfiles = []cellProfile{{name: "a"}, {name: "b"}}
+	g := newTestGrid(t, "absorbing")
+
+	g.assignCellTypes("stripes:3")
+	for i := 0; i < GRID_SIZE; i++ {
+		if got, want := g.cellType[i][7], (i/3)%2; got != want {
+			t.Fatalf("stripes:3 gives column %d type %d, want %d", i, got, want)
+		}
+	}
+	counts := g.cellTypeCounts()
+	if total := counts[0][SUSCEPTIBLE] + counts[1][SUSCEPTIBLE]; total != len(realCells) {
+		t.Errorf("cellTypeCounts holds %d susceptible cells, want %d", total, len(realCells))
+	}
+
+	g.assignCellTypes("ratio:1:0")
+	if counts := g.cellTypeCounts(); counts[1][SUSCEPTIBLE] != 0 {
+		t.Errorf("ratio:1:0 placed %d cells of the second type", counts[1][SUSCEPTIBLE])
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDelayDistributions(t *testing.T) {
+	for _, c := range []struct {
+		spec     string
+		mean, sd float64
+	}{
+		{"fixed:10", 10, 0},
+		{"normal:24:4", 24, 4},
+		{"gamma:24:6", 24, 6},
+		{"lognormal:24:6", 24, 6},
+		{"erlang:24:16", 24, 6},
+	} {
+		d := parseDelay("lysis", c.spec, 12, 3)
+		if d.mean != c.mean || math.Abs(d.sd-c.sd) > 1e-9 {
+			t.Errorf("%s: parsed mean %v, sd %v; want %v, %v", c.spec, d.mean, d.sd, c.mean, c.sd)
+		}
+		for n := 0; n < 20000; n++ {
+			if v := d.sample(nil); v < 1 {
+				t.Fatalf("%s: sampled %d h, want at least 1 h", c.spec, v)
+			}
+		}
+		mean := d.sum / float64(d.n)
+		if math.Abs(mean-c.mean) > 0.5 {
+			t.Errorf("%s: sample mean %.2f h, want %v h", c.spec, mean, c.mean)
+		}
+	}
+}
+
+func TestLegacyDelayUsesTheCallSite(t *testing.T) {
+	d := parseDelay("lysis", "legacy", 12, 3)
+	if v := d.sampleScaled(2, func() int { return -3 }); v != -3 {
+		t.Errorf("legacy delay returned %d, want the call site's -3 unscaled", v)
+	}
+}
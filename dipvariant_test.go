@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseDIPVariants(t *testing.T) {
+	list := parseDIPVariants("short:interference=0.8,advantage=2;long:share=3", false)
+	if len(list) != 2 || list[0].interference != 0.8 || list[0].advantage != 2 || list[1].share != 3 || list[1].advantage != 1 {
+		t.Errorf("parsed %+v", list)
+	}
+	if list := parseDIPVariants("", true); len(list) != 1 || list[0].name != "D0" {
+		t.Errorf("de novo generation without variants starts from %+v, want one ancestral variant", list)
+	}
+	if list := parseDIPVariants("", false); len(list) != 0 {
+		t.Errorf("no variants and no de novo generation gives %+v", list)
+	}
+}
+
+func TestDIPVariantYieldAveragesVariants(t *testing.T) {
+	defer func(list []dipVariant) { dipVariants = list }(dipVariants)
+	dipVariants = []dipVariant{{name: "a", interference: 0.8, advantage: 2}, {name: "b", interference: 0.2, advantage: 1}}
+
+	g := new(Grid)
+	if v, d := g.dipVariantYield(1, 1); v != 1 || d != 1 {
+		t.Errorf("a cell without a variant yields %v, %v, want 1, 1", v, d)
+	}
+	g.dipVariantMask[1][1] = 1 << 0
+	if v, d := g.dipVariantYield(1, 1); math.Abs(v-0.2) > 1e-9 || d != 2 {
+		t.Errorf("a cell with variant a yields %v, %v, want 0.2, 2", v, d)
+	}
+	g.dipVariantMask[1][1] = 1<<0 | 1<<1
+	if v, d := g.dipVariantYield(1, 1); math.Abs(v-0.5) > 1e-9 || d != 1.5 {
+		t.Errorf("a co-infected cell yields %v, %v, want 0.5, 1.5", v, d)
+	}
+}
+
+func TestGenerateDIPVariantJoinsTheCell(t *testing.T) {
+	defer func(list []dipVariant, rate float64) { dipVariants, dipDeNovoRate = list, rate }(dipVariants, dipDeNovoRate)
+	dipVariants = []dipVariant{{name: "D0", advantage: 1, share: 1, parent: "inoculum"}}
+	dipDeNovoRate = math.Inf(1)
+
+	g := new(Grid)
+	g.dipVariantDips = make([][GRID_SIZE][GRID_SIZE]int, 1)
+	g.dipVariantMask[1][1] = 1 << 0
+	g.frameNum = 7
+	g.generateDIPVariant(1, 1, 100)
+	if len(dipVariants) != 2 || len(g.dipVariantDips) != 2 {
+		t.Fatalf("%d variants and %d particle fields after generation, want 2", len(dipVariants), len(g.dipVariantDips))
+	}
+	if v := dipVariants[1]; v.parent != "D0" || v.born != 7 || v.interference < 0 || v.interference > 1 {
+		t.Errorf("new variant is %+v, want parent D0, born at 7 and interference in [0, 1]", v)
+	}
+	if g.dipVariantMask[1][1]&(1<<1) == 0 {
+		t.Errorf("the new variant did not join the producing cell")
+	}
+	g.generateDIPVariant(1, 1, 0)
+	if len(dipVariants) != 2 {
+		t.Errorf("a cell releasing no virions produced a variant")
+	}
+}
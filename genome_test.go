@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestReplicateGenomesGrowsFromOneCopy(t *testing.T) {
+	defer func(model bool, rate, advantage, capacity float64) {
+		intracellularModel, wtReplicationRate, dipSynthesisAdvantage, genomeCapacity = model, rate, advantage, capacity
+	}(intracellularModel, wtReplicationRate, dipSynthesisAdvantage, genomeCapacity)
+	intracellularModel, wtReplicationRate, dipSynthesisAdvantage, genomeCapacity = true, 0.3, 1, 1e6
+
+	g := new(Grid)
+	for j := 0; j < GRID_SIZE; j++ {
+		g.state[0][j] = INFECTED_BOTH
+		g.intraWT[0][j], g.intraDVG[0][j] = 1, 1
+	}
+	for step := 0; step < 10; step++ {
+		g.replicateGenomes()
+	}
+	wt, dvg := g.meanGenomes()
+	// Growth by 1.3 per step gives about 13.8 copies after ten steps
+	if wt < 5 || dvg < 5 {
+		t.Errorf("mean genomes after ten steps at rate 0.3: %.1f WT, %.1f DVG; want growth from one copy", wt, dvg)
+	}
+}
+
+func TestStochasticRoundKeepsTheMean(t *testing.T) {
+	const n = 100000
+	sum := 0
+	for k := 0; k < n; k++ {
+		v := stochasticRound(1.3)
+		if v != 1 && v != 2 {
+			t.Fatalf("stochasticRound(1.3) = %d", v)
+		}
+		sum += v
+	}
+	if mean := float64(sum) / n; mean < 1.28 || mean > 1.32 {
+		t.Errorf("mean of stochasticRound(1.3) is %.3f, want 1.3", mean)
+	}
+}
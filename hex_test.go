@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// newTestGrid builds the neighbour tables of a full well under the given boundary
+// condition, with jump discs of radius 5
+func newTestGrid(t *testing.T, boundary string) *Grid {
+	t.Helper()
+	boundaryCondition = boundary
+	jumpRadiusV, jumpRadiusD = 5, 5
+	noCell = [GRID_SIZE][GRID_SIZE]bool{}
+	loadWellMask("")
+	g := new(Grid)
+	g.initializeNeighbors()
+	return g
+}
+
+func TestOffsetAxialRoundTrip(t *testing.T) {
+	for i := -2; i < GRID_SIZE+2; i++ {
+		for j := -2; j < GRID_SIZE+2; j++ {
+			if ci, cj := axialToOffset(offsetToAxial(i, j)); ci != i || cj != j {
+				t.Errorf("(%d, %d) round-trips to (%d, %d)", i, j, ci, cj)
+			}
+		}
+	}
+}
+
+func TestHexRingAndDiscSizes(t *testing.T) {
+	center := offsetToAxial(7, 4)
+	for radius := 0; radius <= 8; radius++ {
+		ring := hexRing(center, radius)
+		want := 6 * radius
+		if radius == 0 {
+			want = 1
+		}
+		if len(ring) != want {
+			t.Errorf("ring of radius %d has %d cells, want %d", radius, len(ring), want)
+		}
+		for _, h := range ring {
+			if d := hexDistance(center, h); d != radius {
+				t.Errorf("ring of radius %d holds %v at distance %d", radius, h, d)
+			}
+		}
+		disc := hexDisc(center, radius)
+		if want := 1 + 3*radius*(radius+1); len(disc) != want {
+			t.Errorf("disc of radius %d has %d cells, want %d", radius, len(disc), want)
+		}
+		seen := make(map[hexAxial]bool)
+		for _, h := range disc {
+			if seen[h] {
+				t.Errorf("disc of radius %d holds %v twice", radius, h)
+			}
+			seen[h] = true
+		}
+	}
+}
+
+func TestPixelToHexRoundTrip(t *testing.T) {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			x, y := hexToPixel(i, j)
+			if pi, pj := pixelToHex(x, y); pi != i || pj != j {
+				t.Errorf("pixel centre of (%d, %d) maps back to (%d, %d)", i, j, pi, pj)
+			}
+			// Points well inside the hexagon belong to it too
+			for _, d := range [][2]float64{{0.4, 0}, {-0.4, 0}, {0, 0.4}, {0, -0.4}} {
+				px, py := x+d[0]*float64(CELL_SIZE), y+d[1]*float64(CELL_SIZE)
+				if pi, pj := pixelToHex(px, py); pi != i || pj != j {
+					t.Errorf("pixel (%.1f, %.1f) inside (%d, %d) maps to (%d, %d)", px, py, i, j, pi, pj)
+				}
+			}
+		}
+	}
+}
+
+func TestSixHexNeighbours(t *testing.T) {
+	for _, boundary := range []string{"absorbing", "reflecting", "periodic"} {
+		g := newTestGrid(t, boundary)
+		spacing := float64(CELL_SIZE) * math.Sqrt(3)
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				center := offsetToAxial(i, j)
+				x, y := hexToPixel(i, j)
+				if n := len(g.neighborsRingVirion[i][j]); n != 1+3*5*6 {
+					t.Errorf("%s: jump disc of (%d, %d) has %d cells, want the whole radius-5 disc", boundary, i, j, n)
+				}
+				for n, nb := range g.neighbors1[i][j] {
+					ri, rj := axialToOffset(center.add(hexDirections[n]))
+					if ri < 0 || ri >= GRID_SIZE || rj < 0 || rj >= GRID_SIZE {
+						// Across the edge: invalid for absorbing, mapped onto the grid otherwise
+						if (boundary == "absorbing") != (nb == [2]int{-1, -1}) {
+							t.Errorf("%s: edge neighbour %d of (%d, %d) is %v", boundary, n, i, j, nb)
+						}
+						continue
+					}
+					if nb != [2]int{ri, rj} {
+						t.Errorf("%s: neighbour %d of (%d, %d) is %v, want (%d, %d)", boundary, n, i, j, nb, ri, rj)
+						continue
+					}
+					if d := hexDistance(center, offsetToAxial(ri, rj)); d != 1 {
+						t.Errorf("%s: neighbour %v of (%d, %d) is at distance %d", boundary, nb, i, j, d)
+					}
+					nx, ny := hexToPixel(ri, rj)
+					if math.Abs(math.Hypot(nx-x, ny-y)-spacing) > 1e-9 {
+						t.Errorf("%s: neighbour %v of (%d, %d) is not drawn adjacent", boundary, nb, i, j)
+					}
+					if back := g.neighbors1[ri][rj][(n+3)%6]; back != [2]int{i, j} {
+						t.Errorf("%s: (%d, %d) is not a neighbour of its neighbour %v", boundary, i, j, nb)
+					}
+				}
+				if boundary != "absorbing" {
+					continue
+				}
+				for n := 0; n < 6; n++ {
+					for _, nb := range [][2]int{g.neighbors2[i][j][n], g.neighbors3[i][j][n]} {
+						if nb == [2]int{-1, -1} {
+							continue
+						}
+						if d := hexDistance(center, offsetToAxial(nb[0], nb[1])); d != 2 {
+							t.Errorf("distance-2 neighbour %v of (%d, %d) is at distance %d", nb, i, j, d)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestInteriorCellsHaveSixNeighbours(t *testing.T) {
+	g := newTestGrid(t, "absorbing")
+	for i := 1; i < GRID_SIZE-1; i++ {
+		for j := 1; j < GRID_SIZE-1; j++ {
+			seen := make(map[[2]int]bool)
+			for _, nb := range g.neighbors1[i][j] {
+				if nb != [2]int{-1, -1} {
+					seen[nb] = true
+				}
+			}
+			if len(seen) != 6 {
+				t.Errorf("interior cell (%d, %d) has %d distinct neighbours, want 6", i, j, len(seen))
+			}
+		}
+	}
+}
+
+func TestResolveCellBoundaries(t *testing.T) {
+	defer func(boundary string) { boundaryCondition = boundary }(boundaryCondition)
+	noCell = [GRID_SIZE][GRID_SIZE]bool{}
+	last := GRID_SIZE - 1
+	for _, c := range []struct {
+		boundary   string
+		i, j       int
+		wi, wj     int
+		wantOnGrid bool
+	}{
+		{"absorbing", -1, 5, 0, 0, false},
+		{"absorbing", 3, GRID_SIZE, 0, 0, false},
+		{"absorbing", 3, 5, 3, 5, true},
+		{"reflecting", -1, 5, 0, 5, true},
+		{"reflecting", 3, GRID_SIZE + 1, 3, last - 1, true},
+		{"periodic", -1, 5, last, 5, true},
+		{"periodic", 3, GRID_SIZE + 1, 3, 1, true},
+	} {
+		boundaryCondition = c.boundary
+		i, j, ok := resolveCell(c.i, c.j)
+		if ok != c.wantOnGrid || ok && (i != c.wi || j != c.wj) {
+			t.Errorf("%s: resolveCell(%d, %d) = (%d, %d, %v), want (%d, %d, %v)", c.boundary, c.i, c.j, i, j, ok, c.wi, c.wj, c.wantOnGrid)
+		}
+	}
+}
+
+func TestCircleWellMask(t *testing.T) {
+	defer func(boundary string) {
+		boundaryCondition = boundary
+		noCell = [GRID_SIZE][GRID_SIZE]bool{}
+		loadWellMask("")
+	}(boundaryCondition)
+	boundaryCondition = "periodic"
+	noCell = [GRID_SIZE][GRID_SIZE]bool{}
+	loadWellMask("circle:10")
+
+	if len(realCells) == 0 || len(realCells) >= GRID_SIZE*GRID_SIZE {
+		t.Fatalf("circle:10 leaves %d of %d cells", len(realCells), GRID_SIZE*GRID_SIZE)
+	}
+	if noCell[GRID_SIZE/2][GRID_SIZE/2] || !noCell[0][0] {
+		t.Errorf("circle:10 should keep the centre and mask the corner")
+	}
+	for _, c := range realCells {
+		if noCell[c[0]][c[1]] {
+			t.Errorf("masked site %v is listed as a real cell", c)
+		}
+	}
+	if _, _, ok := resolveCell(0, 0); ok {
+		t.Errorf("a masked site resolves as a cell even with a periodic boundary")
+	}
+	for n := 0; n < 1000; n++ {
+		if i, j := randomCell(); noCell[i][j] {
+			t.Fatalf("randomCell returned masked site (%d, %d)", i, j)
+		}
+	}
+}
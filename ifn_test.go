@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPretreatmentOnlyAdvancesIFN(t *testing.T) {
+	defer func(profiles []cellProfile, doses []ifnDose, delay *delayDistribution, halfLife float64, tau int) {
+		cellProfiles, ifnDoses, antiviralDelay, exoIFNHalfLife, antiviralTAU = profiles, doses, delay, halfLife, tau
+	}(cellProfiles, ifnDoses, antiviralDelay, exoIFNHalfLife, antiviralTAU)
+	cellProfiles = []cellProfile{{name: "default", antiviralTAU: 12, ifn: 1}}
+	antiviralTAU = 12
+	antiviralDelay = parseDelay("antiviral", "fixed:6", 12, 3)
+	exoIFNHalfLife = 0
+	ifnDoses = []ifnDose{{time: -24, conc: 5}}
+
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	g.localVirions[10][10], g.localDips[10][10] = 50, 20
+	g.virionLedger.produced, g.virionLedger.deposited = 50, 50
+	g.dipLedger.produced, g.dipLedger.deposited = 20, 20
+	virions, dips := g.localVirions, g.localDips
+	virionLedger, dipLedger := g.virionLedger, g.dipLedger
+
+	for frame := firstIFNDoseTime(); frame < 0; frame++ {
+		g.pretreat(frame)
+	}
+
+	if g.localVirions != virions || g.localDips != dips {
+		t.Errorf("pretreatment moved particles")
+	}
+	if g.virionLedger != virionLedger || g.dipLedger != dipLedger {
+		t.Errorf("pretreatment changed the ledgers: %+v, %+v", g.virionLedger, g.dipLedger)
+	}
+	if got, want := g.totalExogenousIFN(), 5*float64(len(realCells)); got != want {
+		t.Errorf("exogenous IFN is %v, want %v", got, want)
+	}
+	for _, c := range realCells {
+		if s := g.state[c[0]][c[1]]; s != ANTIVIRAL {
+			t.Fatalf("cell %v is in state %d after 24 h of pretreatment, want ANTIVIRAL", c, s)
+		}
+	}
+	if g.antiviralCellCount != len(realCells) {
+		t.Errorf("%d antiviral cells counted, want %d", g.antiviralCellCount, len(realCells))
+	}
+}
+
+func TestGlobalIFNWeightsSpeciesByPotency(t *testing.T) {
+	defer func(profiles []cellProfile, species []ifnSpecies, global float64) {
+		cellProfiles, ifnSpeciesList, globalIFN = profiles, species, global
+	}(cellProfiles, ifnSpeciesList, globalIFN)
+	cellProfiles = []cellProfile{{name: "default", tau: 12, ifn: 1}}
+	ifnSpeciesList = []ifnSpecies{
+		{name: "inert", prodV: 3, potency: 0},
+		{name: "potent", prodV: 2, potency: 1.5},
+	}
+
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	g.state[10][10] = INFECTED_VIRION
+	g.timeSinceInfectVorBoth[10][10] = 100
+	globalIFN = 0
+	g.produceIFNSpecies(10, 10)
+
+	if want := 1.5 * 2 * float64(TIMESTEP); math.Abs(globalIFN-want) > 1e-9 {
+		t.Errorf("global IFN is %v, want %v from the potent species only", globalIFN, want)
+	}
+	if got := g.totalIFNSpecies(0); math.Abs(got-3*float64(TIMESTEP)) > 1e-9 {
+		t.Errorf("the inert species holds %v, want %v", got, 3*float64(TIMESTEP))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestDIPOnlyFateEndsInfectionOnTime(t *testing.T) {
+	defer func(fate string, delay *delayDistribution) {
+		dipOnlyFate, dipFateDelay = fate, delay
+	}(dipOnlyFate, dipFateDelay)
+	dipFateDelay = parseDelay("dipOnlyFate", "fixed:10", 48, 12)
+
+	for _, c := range []struct {
+		fate               string
+		want               int
+		deaths, recoveries int
+	}{
+		{"persist", INFECTED_DIP, 0, 0},
+		{"death", DEAD, 1, 0},
+		{"recover", SUSCEPTIBLE, 0, 1},
+	} {
+		dipOnlyFate = c.fate
+		g := newTestGrid(t, "absorbing")
+		g.initialize()
+		g.state[10][10] = INFECTED_DIP
+		newGrid := g.state
+		g.timeSinceInfectDIP[10][10] = 9
+		g.applyDIPOnlyFate(10, 10, &newGrid)
+		if newGrid[10][10] != INFECTED_DIP {
+			t.Errorf("%s: cell left DIP-only infection after 9 of 10 hours", c.fate)
+		}
+		g.timeSinceInfectDIP[10][10] = 10
+		g.applyDIPOnlyFate(10, 10, &newGrid)
+		if newGrid[10][10] != c.want {
+			t.Errorf("%s: cell is in state %d after 10 hours, want %d", c.fate, newGrid[10][10], c.want)
+		}
+		if g.dipOnlyDeaths != c.deaths || g.dipOnlyRecoveries != c.recoveries {
+			t.Errorf("%s: %d deaths and %d recoveries counted, want %d and %d", c.fate, g.dipOnlyDeaths, g.dipOnlyRecoveries, c.deaths, c.recoveries)
+		}
+	}
+}
+
+func TestDIPOnlyFateSparesSuperinfectedCells(t *testing.T) {
+	defer func(fate string, delay *delayDistribution) {
+		dipOnlyFate, dipFateDelay = fate, delay
+	}(dipOnlyFate, dipFateDelay)
+	dipOnlyFate, dipFateDelay = "death", parseDelay("dipOnlyFate", "fixed:10", 48, 12)
+
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	g.state[10][10] = INFECTED_DIP
+	g.timeSinceInfectDIP[10][10] = 20
+	newGrid := g.state
+	newGrid[10][10] = INFECTED_BOTH
+	g.applyDIPOnlyFate(10, 10, &newGrid)
+	if newGrid[10][10] != INFECTED_BOTH || g.dipOnlyDeaths != 0 {
+		t.Errorf("a cell superinfected this step was killed as DIP-only")
+	}
+}
+
+func TestSuperinfectionExclusionWindow(t *testing.T) {
+	defer func(window int) { superinfectionExclusion = window }(superinfectionExclusion)
+
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	g.state[10][10] = INFECTED_VIRION
+	g.timeSinceInfectVorBoth[10][10] = 5
+	g.state[12][12] = INFECTED_DIP
+	g.timeSinceInfectDIP[12][12] = 5
+
+	superinfectionExclusion = -1
+	if g.excludesSuperinfection(10, 10) || g.excludesSuperinfection(12, 12) {
+		t.Errorf("co-infection excluded with the window off")
+	}
+	superinfectionExclusion = 6
+	if g.excludesSuperinfection(10, 10) || g.excludesSuperinfection(12, 12) {
+		t.Errorf("co-infection excluded 5 hours into a 6-hour window")
+	}
+	superinfectionExclusion = 5
+	for step := 0; step < 3; step++ {
+		if !g.excludesSuperinfection(10, 10) || !g.excludesSuperinfection(12, 12) {
+			t.Fatalf("co-infection allowed past the window")
+		}
+	}
+	if g.excludedCells != 2 {
+		t.Errorf("%d excluded cells counted, want each cell once", g.excludedCells)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestApplyInitialConditions(t *testing.T) {
+	defer func(list []initialElement) { initialConditions = list }(initialConditions)
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	initialConditions = parseInitialConditions("focus,at=10:10,r=1,v=30,d=0,infected=1; antiviral,disc=20:20:1; dead,rect=0:0:1:1")
+	if len(initialConditions) != 3 {
+		t.Fatalf("parsed %d elements, want 3", len(initialConditions))
+	}
+	g.applyInitialConditions()
+
+	focus := hexDiscCells(10, 10, 1)
+	virions := 0
+	for _, c := range focus {
+		if g.state[c[0]][c[1]] != INFECTED_VIRION {
+			t.Errorf("focus cell %v is in state %d, want INFECTED_VIRION", c, g.state[c[0]][c[1]])
+		}
+		virions += g.localVirions[c[0]][c[1]]
+	}
+	if virions != 30 || g.totalVirions() != 30 || g.totalDIPs() != 0 {
+		t.Errorf("focus placed %d of 30 virions in its disc (%d on the grid, %d DIPs)", virions, g.totalVirions(), g.totalDIPs())
+	}
+	if e := initialConditions[0]; e.seededCells != 7 || e.seededV != 30 {
+		t.Errorf("focus recorded %d cells and %d virions, want 7 and 30", e.seededCells, e.seededV)
+	}
+	for _, c := range hexDiscCells(20, 20, 1) {
+		if g.state[c[0]][c[1]] != ANTIVIRAL {
+			t.Errorf("antiviral region cell %v is in state %d", c, g.state[c[0]][c[1]])
+		}
+	}
+	if g.antiviralCellCount != 7 {
+		t.Errorf("%d antiviral cells counted, want 7", g.antiviralCellCount)
+	}
+	for _, c := range [][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}} {
+		if g.state[c[0]][c[1]] != DEAD {
+			t.Errorf("dead region cell %v is in state %d", c, g.state[c[0]][c[1]])
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestParseInterventions(t *testing.T) {
+	list := parseInterventions("wash,t=24,fraction=0.9; drug,t=12,until=36,rho=0.5,burst=0.25; ifn,t=30,conc=5,disc=25:25:8")
+	if len(list) != 3 {
+		t.Fatalf("parsed %d interventions, want 3", len(list))
+	}
+	if e := list[0]; e.kind != "wash" || e.time != 24 || e.fraction != 0.9 {
+		t.Errorf("wash parsed as %+v", e)
+	}
+	if e := list[1]; e.kind != "drug" || e.time != 12 || e.until != 36 || e.rho != 0.5 || e.burst != 0.25 {
+		t.Errorf("drug parsed as %+v", e)
+	}
+	if e := list[2]; e.kind != "ifn" || e.time != 30 || e.dose.conc != 5 || len(e.dose.cells) == 0 {
+		t.Errorf("ifn parsed as %+v", e)
+	}
+}
+
+func TestWashKeepsTheLedgerBalanced(t *testing.T) {
+	g := new(Grid)
+	for i := 0; i < GRID_SIZE; i++ {
+		g.localVirions[i][i], g.localDips[i][i] = 40, 10
+	}
+	g.virionLedger.deposited, g.dipLedger.deposited = g.totalVirions(), g.totalDIPs()
+
+	v, d := g.wash(0.25)
+	if v+g.totalVirions() != 40*GRID_SIZE || d+g.totalDIPs() != 10*GRID_SIZE {
+		t.Errorf("wash removed %d virions and %d DIPs but %d and %d remain", v, d, g.totalVirions(), g.totalDIPs())
+	}
+	if g.totalVirions() != g.virionLedger.deposited-g.virionLedger.washed || g.totalDIPs() != g.dipLedger.deposited-g.dipLedger.washed {
+		t.Errorf("ledgers do not balance after a wash: %+v, %+v", g.virionLedger, g.dipLedger)
+	}
+	if v == 0 || g.totalVirions() == 0 {
+		t.Errorf("a 75%% wash of %d virions removed %d", 40*GRID_SIZE, v)
+	}
+}
+
+func TestOverlayTargetsOneParticleType(t *testing.T) {
+	defer func(v, d spreadSettings, list []intervention, rv, rd int) {
+		virionSpread, dipSpread, interventions, jumpRadiusV, jumpRadiusD = v, d, list, rv, rd
+	}(virionSpread, dipSpread, interventions, jumpRadiusV, jumpRadiusD)
+	g := newTestGrid(t, "absorbing")
+	virionSpread = spreadSettings{mode: "celltocell", kJumpR: 0.2}
+	dipSpread = spreadSettings{mode: "jumpradius", radius: 5, kJumpR: 0.7}
+	dipRing := g.neighborsRingDIP[10][10]
+
+	interventions = parseInterventions("overlay,t=3,target=virions,mode=partition")
+	g.applyInterventions(3)
+	if virionSpread.mode != "partition" || virionSpread.kJumpR != 0.2 {
+		t.Errorf("virions after the overlay: %+v, want partition keeping kJumpR 0.2", virionSpread)
+	}
+	if dipSpread.mode != "jumpradius" || dipSpread.radius != 5 || dipSpread.kJumpR != 0.7 || len(g.neighborsRingDIP[10][10]) != len(dipRing) {
+		t.Errorf("a virion overlay changed the DIP settings to %+v", dipSpread)
+	}
+
+	interventions = parseInterventions("overlay,t=4,target=dips,radius=2")
+	g.applyInterventions(4)
+	if dipSpread.mode != "jumpradius" || dipSpread.radius != 2 || len(g.neighborsRingDIP[10][10]) != 1+3*2*3 {
+		t.Errorf("DIPs after a radius overlay: %+v with %d jump targets", dipSpread, len(g.neighborsRingDIP[10][10]))
+	}
+	if virionSpread.mode != "partition" {
+		t.Errorf("a DIP overlay changed the virion mode to %s", virionSpread.mode)
+	}
+}
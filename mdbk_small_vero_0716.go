@@ -29,6 +29,7 @@ import (
 	"math"
 	"math/rand"
 	"os" // Used for file operations
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -72,6 +73,10 @@ var (
 	flag_burstSizeD       = flag.Int("burstSizeD", 100, "Number of DIPs released when a cell lyses")
 	flag_meanLysisTime    = flag.Float64("meanLysisTime", 12.0, "Mean lysis time")
 	flag_kJumpR           = flag.Float64("kJumpR", 0.5, "Parameter for cell-to-cell jump randomness")
+	flag_jumpRadiusV      = flag.Int("jumpRadiusV", 5, "Virion jump radius in cells for jumpradius spread")
+	flag_jumpRadiusD      = flag.Int("jumpRadiusD", 5, "DIP jump radius in cells for jumpradius spread")
+	flag_kJumpRV          = flag.Float64("kJumpRV", -1, "Random-jump fraction of virions in partition spread (negative = kJumpR)")
+	flag_kJumpRD          = flag.Float64("kJumpRD", -1, "Random-jump fraction of DIPs in partition spread (negative = kJumpR)")
 	flag_tau              = flag.Int("tau", 12, "TAU value (e.g., lysis time)")
 	flag_ifnBothFold      = flag.Float64("ifnBothFold", 1.0, "Fold effect for IFN stimulation")
 	flag_rho              = flag.Float64("rho", 0.026, "Infection rate constant")
@@ -82,1017 +87,3970 @@ var (
 
 	flag_v_pfu_initial = flag.Float64("v_pfu_initial", 1.0, "Initial PFU count for virions")
 	flag_d_pfu_initial = flag.Float64("d_pfu_initial", 0.0, "Initial PFU count for DIPs")
-	flag_videotype     = flag.String("videotype", "states", "Video type: states, IFNconcentration, IFNonlyLargerThanZero, antiviralState, particles")
+	flag_videotype     = flag.String("videotype", "states", "Video type: states, strains, IFNconcentration, IFNonlyLargerThanZero, antiviralState, particles, IFN_<species name>")
+
+	// Per-type spread modes, e.g. -virionSpreadOption=jumpradius -dipSpreadOption=celltocell
+	flag_virionSpreadOption = flag.String("virionSpreadOption", "", "Virion spread option: celltocell, jumprandomly, jumpradius, or partition (empty = particleSpreadOption)")
+	flag_dipSpreadOption    = flag.String("dipSpreadOption", "", "DIP spread option: celltocell, jumprandomly, jumpradius, or partition (empty = particleSpreadOption)")
+	// Dispersal kernels, e.g. "gaussian:2", "exponential:3", "powerlaw:2.5", "disc:5" (lengths in cell spacings)
+	flag_virionKernel = flag.String("virionKernel", "", "Virion dispersal kernel: nearest, gaussian:σ, exponential:λ, powerlaw:α or disc:r; empty = particleSpreadOption")
+	flag_dipKernel    = flag.String("dipKernel", "", "DIP dispersal kernel: nearest, gaussian:σ, exponential:λ, powerlaw:α or disc:r; empty = particleSpreadOption")
+
+	flag_boundary                = flag.String("boundary", "absorbing", "Boundary condition: absorbing (off-grid particles are lost and counted), reflecting, or periodic")
+	flag_deposition              = flag.String("deposition", "legacy", "Cell-to-cell deposition: legacy (distance-1 only onto susceptible cells), all, live, or susceptible (redirect the rest)")
+	flag_legacyDIPBurst          = flag.Bool("legacyDIPBurst", false, "Reproduce the original model's DIP bursts: doubled under jumprandomly and jumpradius DIP spread, BURST_SIZE_D without virions at the cell under partition")
+	flag_particleUptake          = flag.String("particleUptake", "none", "Particles removed when they infect a cell: none, infecting (one per infecting type), or all (every particle at the cell)")
+	flag_superinfectionExclusion = flag.Int("superinfectionExclusion", -1, "Hours after first infection beyond which an infected cell can no longer be co-infected (-1 = never excluded)")
+	flag_debug                   = flag.Bool("debug", false, "Run self-checks (burst conservation) and stop on the first violation")
+
+	// Intracellular WT/DVG model; -dipSynthesisAdvantage is also passed by the Shiny app
+	flag_intracellular         = flag.Bool("intracellular", false, "Derive burst sizes and DIP IFN stimulation from intracellular WT/DVG genome replication")
+	flag_wtReplicationRate     = flag.Float64("wtReplicationRate", 0.8, "Intracellular WT genome replication rate per hour")
+	flag_dipSynthesisAdvantage = flag.Float64("dipSynthesisAdvantage", 4.0, "DVG genome replication rate relative to WT")
+	flag_genomeCapacity        = flag.Float64("genomeCapacity", 1000, "Genome copies a cell can hold; a full cell releases the whole burst")
+
+	// Virus release: one lysis burst, continuous budding after an eclipse period, or both
+	flag_releaseMode   = flag.String("releaseMode", "burst", "Virus release: burst (all at lysis), budding (continuous, no lysis burst), or mixed (budding plus the lysis burst)")
+	flag_buddingRate   = flag.Float64("buddingRate", 2.0, "Virions budded per hour by a cell whose burst would be BURST_SIZE_V; DIPs bud in proportion to the DIP burst")
+	flag_eclipsePeriod = flag.Int("eclipsePeriod", 6, "Hours after infection before a cell starts budding")
+
+	// Delay distributions: legacy keeps the untruncated normals, otherwise e.g. "gamma:18:4", "erlang:24:6", "fixed:12"
+	flag_lysisTimeDist       = flag.String("lysisTimeDist", "legacy", "Lysis time: legacy, normal[:mean[:sd]] (truncated at 1h), gamma[:mean[:sd]], lognormal[:mean[:sd]], erlang[:mean[:k]] or fixed[:hours]")
+	flag_antiviralDelayDist  = flag.String("antiviralDelayDist", "legacy", "Delay from IFN exposure to the antiviral state, same families as -lysisTimeDist (default mean TAU)")
+	flag_dipOnlyFate         = flag.String("dipOnlyFate", "persist", "Fate of DIP-only infected cells: persist (stay infected), death (abortive death) or recover (back to susceptible)")
+	flag_dipOnlyFateTimeDist = flag.String("dipOnlyFateTimeDist", "gamma:48:12", "Time from DIP-only infection to death or recovery, same families as -lysisTimeDist except legacy")
+	flag_regrowthModel       = flag.String("regrowthModel", "delay", "Regrowth of dead sites: delay (after -regrowthTimeDist next to a live cell) or proliferation (live neighbours divide into the site)")
+	flag_proliferationRate   = flag.Float64("proliferationRate", 0.05, "Per-hour division rate into an empty site fully surrounded by live cells; scaled by the live fraction of its neighbours")
+	flag_regrowthInherit     = flag.String("regrowthInheritance", "none", "State passed to daughter cells: none (daughters start as regrowth cells) or antiviral (daughters of antiviral cells are antiviral)")
+	flag_regrowthTimeDist    = flag.String("regrowthTimeDist", "legacy", "Time from death to regrowth, same families as -lysisTimeDist; non-legacy draws once per dead cell")
+
+	// Cell types: profiles override -tau, IFN production, -rho and -meanLysisTime per cell, e.g.
+	// "mdbk:tau=12,ifn=1;vero:tau=0,rho=0.03,lysis=16" with -cellTypeLayout=ratio:3:1
+	flag_cellTypes      = flag.String("cellTypes", "", "Cell-type profiles: name:tau=,ifn=,rho=,lysis= separated by ';' (missing keys use the global flags); empty = one cell type")
+	flag_cellTypeLayout = flag.String("cellTypeLayout", "", "Cell-type placement: ratio:w1:w2..., stripes:width, checker:size, islands:radius:count (first type on the last) or a PNG path (grey bands, dark = first type); empty = equal ratio")
+
+	// Virus strains, e.g. "wt:rho=0.026,burst=50;antagonist:ifn=0.1,lysis=14,share=0.5"
+	flag_strains           = flag.String("strains", "", "Virus strains: name:rho=,burst=,lysis=,ifn=,share=,color=RRGGBB separated by ';' (missing keys use the global flags); empty = one strain")
+	flag_strainCoinfection = flag.String("strainCoinfection", "first", "A second strain infecting an infected cell: first (ignored), split (the cell releases both) or replace (the new strain takes over)")
+
+	// DIP variants, e.g. "short:interference=0.8,advantage=3;long:interference=0.3,share=0.5"
+	flag_dipVariants   = flag.String("dipVariants", "", "DIP variants: name:interference=,advantage=,share= separated by ';'; empty = one homogeneous DIP")
+	flag_dipDeNovoRate = flag.Float64("dipDeNovoRate", 0, "Chance per released virion that replication produces a new DIP variant in the releasing cell (0 = no de novo DIPs)")
+
+	// Plaque readout, also used by the titrate command
+	flag_plaqueTime    = flag.Int("plaqueTime", -1, "Time step at which plaques (connected groups of dead cells) are counted into plaques.csv (-1 = no readout)")
+	flag_minPlaqueSize = flag.Int("minPlaqueSize", 3, "Smallest group of connected dead cells counted as a plaque")
+
+	// Well geometry mask: "circle", "circle:20", "annulus:8:24" (radii in cell spacings from the centre cell) or a PNG file
+	flag_wellMask = flag.String("wellMask", "", "Well mask: circle[:radius], annulus:inner:outer, or a PNG path (dark pixels = no cell); empty = full grid")
+	// Exogenous IFN doses, e.g. "t=-24,conc=10;t=0,conc=5,disc=25:25:8;t=12,conc=2,rect=0:0:9:49"
+	flag_ifnDose        = flag.String("ifnDose", "", "Exogenous IFN doses: t=<hour>,conc=<per cell>[,disc=i:j:r|rect=i0:j0:i1:j1] separated by ';' (negative t = pretreatment)")
+	flag_exoIFNHalfLife = flag.Float64("exoIFNHalfLife", 4.0, "Half-life of exogenous IFN in hours (0 = no decay)")
+	flag_ifnResponseTau = flag.Int("ifnResponseTau", 12, "Antiviral induction time used for exogenous IFN when cells do not produce IFN (TAU = 0)")
+	// IFN species: empty keeps the single IFN field, otherwise e.g.
+	// "typeI:radius=10,halfLife=4,prodV=1,prodD=5,prodBoth=11,potency=1;typeIII:radius=3,halfLife=2,prodV=0.5,prodD=5,prodBoth=5,potency=2"
+	flag_ifnSpecies = flag.String("ifnSpecies", "", "IFN species spec: name:radius=,halfLife=,prodV=,prodD=,prodBoth=,potency= separated by ';' (requires -ifnSpreadOption=local)")
+	// Timed interventions, e.g. "wash,t=24,fraction=0.9;drug,t=12,until=36,rho=0.5;ifn,t=30,conc=5,disc=25:25:8;overlay,t=48,mode=jumprandomly"
+	flag_interventions = flag.String("interventions", "", "Intervention schedule separated by ';': wash,t=,fraction= | drug,t=,until=,rho=,burst= | ifn,t=,conc=[,disc=|rect=] | overlay,t=[,target=virions|dips|both,mode=,radius=,kJumpR=,kernel=] (omitted settings are kept)")
+
+	// Settings file, one "key = value" per line, e.g. "initialCondition = focus,at=10:10,v=20"
+	// followed by "initialCondition = antiviral,disc=25:25:4" (repeated keys are joined by ';')
+	flag_config           = flag.String("config", "", "File of flag settings, one key = value per line (# comments); command-line flags take precedence")
+	flag_initialState     = flag.String("initialState", "", "Starting grid: a states PNG (gridToImage palette, as the snapshots) or a CSV of i,j,state,virions,dips,ifn; replaces -option, -initialCondition is applied on top")
+	flag_snapshotTimes    = flag.String("snapshotTimes", "", "Comma-separated time steps at which snapshot_tNNN.csv and .png are saved; both can be loaded with -initialState")
+	flag_endTime          = flag.Int("endTime", TIME_STEPS-1, "Last time step simulated")
+	flag_initialCondition = flag.String("initialCondition", "", "Initial condition, replacing -option: focus,at=i:j[,v=,d=,r=,infected=1] | moi,v=[,d=] | gradient,at=i:j,v=[,d=,length=] | antiviral|dead,disc=i:j:r|rect=i0:j0:i1:j1, separated by ';'")
 )
 
 // Particle spread related
 var (
-	particleSpreadOption  string  // "celltocell", "jumprandomly", "jumpradius"
-	jumpRadiusV           int     // e.g., when "jumpradius" is selected, set to 5
-	jumpRadiusD           int     // same as above
-	jumpRandomly          bool    // whether to use random jump (true when "jumprandomly" is selected)
-	k_JumpR               float64 // random jump ratio
-	par_celltocell_random bool
+	particleSpreadOption    string  // "celltocell", "jumprandomly", "jumpradius"
+	jumpRadiusV             int     // e.g., when "jumpradius" is selected, set to 5
+	jumpRadiusD             int     // same as above
+	jumpRandomly            bool    // whether to use random jump (true when "jumprandomly" is selected)
+	k_JumpR                 float64 // random jump ratio
+	par_celltocell_random   bool
+	boundaryCondition       string  // "absorbing", "reflecting" or "periodic"
+	depositionPolicy        string  // "legacy", "all", "live" or "susceptible"
+	debugMode               bool    // run self-checks during the simulation
+	particleUptake          string  // "none", "infecting" or "all"
+	legacyDIPBurst          bool    // DIP burst quirks of the original model, see -legacyDIPBurst
+	superinfectionExclusion int     // hours after first infection when co-infection stops, -1 = off
+	releaseMode             string  // "burst", "budding" or "mixed"
+	buddingRate             float64 // virions per hour at a full burst size
+	eclipsePeriod           int     // hours before budding starts
 )
 
-// IFN spread related
+// Delay distributions for lysis, the antiviral response and regrowth
 var (
-	ifnSpreadOption string // "global",
-	//  "local", "noIFN"
-	IFN_wave_radius int  // if ifnSpreadOption=="local", e.g., set to 10; "global" or "noIFN" set to 0
-	ifnWave         bool // whether to enable IFN wave
+	lysisDelay     *delayDistribution
+	antiviralDelay *delayDistribution
+	regrowthDelay  *delayDistribution
+	dipFateDelay   *delayDistribution
+	dipOnlyFate    string // "persist", "death" or "recover"
 )
 
-// DIP related
+// Regrowth related
 var (
-	dipOption bool // true to enable DIP, false to disable DIP
-
-	// When DIP is enabled, default DIP-related ratios remain default; when disabled, set to 0
-	D_only_IFN_stimulate_ratio float64 = 5.0 * ifnBothFold
-	BOTH_IFN_stimulate_ratio   float64 = 10.0 * ifnBothFold
+	regrowthModel       string  // "delay" or "proliferation"
+	proliferationRate   float64 // per hour, for a site surrounded by live cells
+	regrowthInheritance string  // "none" or "antiviral"
 )
 
-// Global variables
+// Plaque readout
 var (
-	// particleSpreadOption  = "jumpradius" // options: "celltocell", "jumprandomly", "jumpradius"
-	// PartionParticleSpreadOption = false // options: "true" or "false"
-
-	//ifnSpreadOption = "global" // options: "global", "local" or "noIFN"
-	//dipOption =
-
-	BURST_SIZE_V  int    // CHANGE 50 Number of virions released when a cell lyses
-	BURST_SIZE_D  int    // CHANGE 100 // Number of DIPs released when a cell lyses
-	VStimulateIFN = true // CHANGE if false then usually only DIP stimulate IFN in this situlation, not virion
-	//jumpRandomly          = true // CHANGE
-	//jumpRadiusV           = 0    // CHANGE Virion jump radius
-	//jumpRadiusD           = 0    // CHANGE DIP jump radius
-	//IFN_wave_radius       = 10   // CHANGE 10
-	// this is true only when jumpRandomly is true
+	plaqueTime    int // time step of the plaque count, -1 = none
+	minPlaqueSize int // cells
+)
 
-	TAU         int // 95
-	ifnBothFold = 1.0
-	//D_only_IFN_stimulate_ratio = 5.0 * ifnBothFold  // D/V *R *D_only_IFN_stimulate_ratio
-	//BOTH_IFN_stimulate_ratio = 10.0 * ifnBothFold // D/V *R *D_only_IFN_stimulate_ratio
+// IFN spread related
+var (
+	ifnSpreadOption string // "global",
+	//  "local", "noIFN"
+	IFN_wave_radius int  // if ifnSpreadOption=="local", e.g., set to 10; "global" or "noIFN" set to 0
+	ifnWave         bool // whether to enable IFN wave
+	ifnSpeciesList  []ifnSpecies
 
-	// option    = 2        // Option for infection initialization
-	//videotype = "states" // "states" // color in "states" or "IFNconcentration" or "IFNonlyLargerThanZero" or "antiviralState" or "particles"
-	RHO    float64 //0.026    //0.02468  // 0.09 Infection rate constant
-	option int
-	// radius 10 of grid has 331 cells
-	R int
-	// radius 10 of grid has 331 cells, originally infected cell increases R IFN,
-	ALPHA = 1.0 // Parameter for infection probability (set to 1.5)
+	ifnDoses       []ifnDose
+	exoIFNHalfLife float64
+	antiviralTAU   int // antiviral induction time, TAU unless only exogenous IFN is present
+)
 
-	REGROWTH_MEAN       = 24.0  // Mean time for regrowth
-	REGROWTH_STD        = 6.0   // Standard deviation for regrowth time
-	MEAN_LYSIS_TIME     float64 // Mean lysis time
-	STANDARD_LYSIS_TIME float64 // Standard deviation for lysis time
-	maxGlobalIFN        = -1.0  // used to track maximum IFN value
-	globalIFN           = -1.0  // global IFN concentration
-	globalIFNperCell    = 0.0
-	IFN_DELAY           = 5
-	STD_IFN_DELAY       = 1
+// Exogenous IFN added to the medium at a given hour; cells == nil means the whole well
+type ifnDose struct {
+	time  int
+	conc  float64
+	cells [][2]int
+}
 
-	// allowVirionJump = jumpRadiusV > 0 || jumpRandomly // Allow virions to jump to other cells
-	// allowDIPJump = jumpRadiusD > 0 || jumpRandomly // Allow DIPs to jump to other cells
-	allowVirionJump bool
-	allowDIPJump    bool
-	//ifnWave = IFN_wave_radius > 0
+// parseIFNDoses parses the -ifnDose spec
+func parseIFNDoses(spec string) []ifnDose {
+	var doses []ifnDose
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		d := ifnDose{}
+		hasTime, hasConc := false, false
+		for _, kv := range strings.Split(entry, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				log.Fatalf("Invalid IFN dose parameter %q in %q", kv, entry)
+			}
+			switch key {
+			case "t":
+				t, err := strconv.Atoi(value)
+				if err != nil {
+					log.Fatalf("Invalid IFN dose time %q: %v", value, err)
+				}
+				d.time, hasTime = t, true
+			case "conc":
+				c, err := strconv.ParseFloat(value, 64)
+				if err != nil || c < 0 {
+					log.Fatalf("Invalid IFN dose concentration %q", value)
+				}
+				d.conc, hasConc = c, true
+			case "disc", "rect":
+				d.cells = parseRegion(key, value, entry)
+			default:
+				log.Fatalf("Unknown IFN dose parameter %q in %q", key, entry)
+			}
+		}
+		if !hasTime || !hasConc {
+			log.Fatalf("IFN dose %q needs both t= and conc=", entry)
+		}
+		doses = append(doses, d)
+	}
+	return doses
+}
 
-	yMax          float64
-	xMax          = float64(TIME_STEPS)
-	ticksInterval float64 // Interval for X-axis ticks
+// parseRegion returns the well cells of a disc=i:j:r or rect=i0:j0:i1:j1 region
+func parseRegion(key, value, context string) [][2]int {
+	cells := [][2]int{}
+	if key == "disc" {
+		v := parseIntList(value, 3, context)
+		return append(cells, hexDiscCells(v[0], v[1], v[2])...)
+	}
+	v := parseIntList(value, 4, context)
+	for ni := max(v[0], 0); ni <= min(v[2], GRID_SIZE-1); ni++ {
+		for nj := max(v[1], 0); nj <= min(v[3], GRID_SIZE-1); nj++ {
+			if !noCell[ni][nj] {
+				cells = append(cells, [2]int{ni, nj})
+			}
+		}
+	}
+	return cells
+}
 
-	adjusted_DIP_IFN_stimulate   float64
-	perParticleInfectionChance_V float64
-	totalDeadFromBoth            int
-	totalDeadFromV               int
-	virionDiffusionRate          int
-	dipDiffusionRate             int
+// One element of the -initialCondition spec. v and d are the particles of a focus, the
+// MOI of Poisson seeding or the peak MOI of a gradient; cells is the region of an
+// antiviral or dead element. The seeded totals are recorded for initial_condition.csv.
+type initialElement struct {
+	kind     string // "focus", "moi", "gradient", "antiviral" or "dead"
+	spec     string
+	at       [2]int
+	radius   int
+	v, d     float64
+	length   float64
+	infected bool
+	cells    [][2]int
+
+	seededCells, seededV, seededD int
+}
 
-	virion_half_life float64 //= 0.0 // 3.2 // ~4 d^-1 => half-life ~4.2 hours
-	dip_half_life    float64 //= 0.0 // 3.2 // ~4 d^-1 => half-life ~4.2 hours
-	ifn_half_life    float64 //= 0.0 // 3.0 // ~3 d^-1 => half-life ~5.5 hours
-	videotype        string
-	dipAdvantage     float64 // DIP advantage = burstSizeD / burstSizeV
+var (
+	initialConditions []initialElement // empty: seed by -option
+	initialState      string           // PNG or CSV path, empty = none
+	snapshotTimes     []int
 )
 
-// Cell state definitions
-const (
-	SUSCEPTIBLE     = 0 // Susceptible state
-	INFECTED_VIRION = 1 // Infected by virion
-	INFECTED_DIP    = 5 // Infected by DIP
-	INFECTED_BOTH   = 6 // Infected by both virion and DIP
-	DEAD            = 2 // Dead state
-	ANTIVIRAL       = 3 // Antiviral state
-	REGROWTH        = 4 // Regrowth state
-)
+// Colours of the states video, also used to read states PNGs
+var stateColors = map[int]color.RGBA{
+	SUSCEPTIBLE:     {0, 0, 0, 255},       // Susceptible state: black
+	INFECTED_VIRION: {255, 0, 0, 255},     // Infected by virion: red
+	INFECTED_DIP:    {0, 255, 0, 255},     // Infected by DIP: green
+	INFECTED_BOTH:   {255, 255, 0, 255},   // Infected by both: yellow
+	DEAD:            {169, 169, 169, 255}, // Dead state: gray
+	ANTIVIRAL:       {0, 0, 255, 255},     // Antiviral state: blue
+	REGROWTH:        {128, 0, 128, 255},   // Regrowth state: purple
+	MASKED:          {235, 235, 235, 255}, // Outside the well: light gray
+}
 
-// Grid structure for storing the simulation state
-type Grid struct {
-	state                  [GRID_SIZE][GRID_SIZE]int        // State of the cells in the grid
-	localVirions           [GRID_SIZE][GRID_SIZE]int        // Number of virions in each cell
-	localDips              [GRID_SIZE][GRID_SIZE]int        // Number of DIPs in each cell
-	IFNConcentration       [GRID_SIZE][GRID_SIZE]float64    // IFN concentration in each cell
-	timeSinceInfectVorBoth [GRID_SIZE][GRID_SIZE]int        // Time since infection for each cell
-	timeSinceInfectDIP     [GRID_SIZE][GRID_SIZE]int        // Time since infection for each cell
-	timeSinceDead          [GRID_SIZE][GRID_SIZE]int        // Time since death for each cell
-	timeSinceRegrowth      [GRID_SIZE][GRID_SIZE]int        // Time since regrowth for each cell
-	timeSinceSusceptible   [GRID_SIZE][GRID_SIZE]int        // Time since cell became susceptible
-	neighbors1             [GRID_SIZE][GRID_SIZE][6][2]int  // Neighbors at distance 1
-	neighbors2             [GRID_SIZE][GRID_SIZE][6][2]int  // Neighbors at distance 2
-	neighbors3             [GRID_SIZE][GRID_SIZE][6][2]int  // Neighbors at distance 3
-	neighborsRingVirion    [GRID_SIZE][GRID_SIZE][60][2]int // Neighbors at distance 10 ring
-	neighborsRingDIP       [GRID_SIZE][GRID_SIZE][60][2]int // Neighbors at distance 10 ring
-	neighborsIFNArea       [GRID_SIZE][GRID_SIZE][][2]int   // Neighbors within IFN wave radius
-	stateChanged           [GRID_SIZE][GRID_SIZE]bool       // Flag to indicate if the state of a cell has changed
-	antiviralDuration      [GRID_SIZE][GRID_SIZE]int        // Duration of antiviral state
-	previousStates         [GRID_SIZE][GRID_SIZE]int        // Previous state of the cell
-	antiviralFlag          [GRID_SIZE][GRID_SIZE]bool       // Flag to indicate if the cell is in the antiviral state
-	timeSinceAntiviral     [GRID_SIZE][GRID_SIZE]int        // Time since the cell entered the antiviral state
-	antiviralCellCount     int                              // Number of cells in the antiviral state
-	totalAntiviralTime     int
-	intraWT                [GRID_SIZE][GRID_SIZE]int // IntraWT
-	intraDVG               [GRID_SIZE][GRID_SIZE]int // IntraDVG
-	allowJumpRandomly      [][]bool
-	totalRandomJumpVirions int                       // record total number of randomly jumping Virions
-	totalRandomJumpDIPs    int                       // record total number of randomly jumping DIPs
-	lysisThreshold         [GRID_SIZE][GRID_SIZE]int // fixed lysis time for each cell
+// Names of the states in snapshot CSVs, indexed by state
+var stateNames = []string{"susceptible", "infectedV", "dead", "antiviral", "regrowth", "infectedDIP", "infectedBoth", "masked"}
 
+// parseInitialConditions parses the -initialCondition spec
+func parseInitialConditions(spec string) []initialElement {
+	var list []initialElement
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ",")
+		e := initialElement{kind: strings.TrimSpace(parts[0]), spec: entry, at: [2]int{-1, -1}, length: 5}
+		if e.kind == "focus" {
+			e.v, e.d = *flag_v_pfu_initial, *flag_d_pfu_initial
+		}
+		for _, kv := range parts[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				log.Fatalf("Invalid initial-condition parameter %q in %q", kv, entry)
+			}
+			switch key {
+			case "at":
+				v := parseIntList(value, 2, entry)
+				ni, nj, ok := resolveCell(v[0], v[1])
+				if !ok || ni != v[0] || nj != v[1] {
+					log.Fatalf("Initial condition %q: (%d, %d) is not a cell of the well", entry, v[0], v[1])
+				}
+				e.at = [2]int{ni, nj}
+			case "disc", "rect":
+				e.cells = parseRegion(key, value, entry)
+			case "infected":
+				e.infected = value == "1" || value == "true"
+			case "r":
+				r, err := strconv.Atoi(value)
+				if err != nil || r < 0 {
+					log.Fatalf("Invalid radius %q in %q", value, entry)
+				}
+				e.radius = r
+			case "v", "d", "length":
+				x, err := strconv.ParseFloat(value, 64)
+				if err != nil || x < 0 || key == "length" && x == 0 {
+					log.Fatalf("Invalid value for %s in initial condition %q", key, entry)
+				}
+				switch key {
+				case "v":
+					e.v = x
+				case "d":
+					e.d = x
+				default:
+					e.length = x
+				}
+			default:
+				log.Fatalf("Unknown initial-condition parameter %q in %q", key, entry)
+			}
+		}
+		switch e.kind {
+		case "focus", "gradient":
+			if e.at[0] < 0 {
+				log.Fatalf("Initial condition %q needs at=i:j", entry)
+			}
+		case "antiviral", "dead":
+			if e.cells == nil {
+				log.Fatalf("Initial condition %q needs disc= or rect=", entry)
+			}
+		case "moi":
+		default:
+			log.Fatalf("Unknown initial condition %q: want focus, moi, gradient, antiviral or dead", e.kind)
+		}
+		list = append(list, e)
+	}
+	return list
 }
 
-// Initialize the infection state
-func (g *Grid) initializeInfection(option int) {
-	// Use current time as seed for reproducibility
-	rand.Seed(time.Now().UnixNano())
+// applyInitialConditions seeds the grid from the -initialCondition elements in order.
+// A focus scatters its v virions and d DIPs over the hex disc of radius r around at and,
+// with infected=1, infects the disc cells as -option=2 does; moi gives every cell
+// Poisson(v) virions and Poisson(d) DIPs, and a gradient the same with MOIs falling off
+// as exp(-distance/length) from at. Antiviral and dead regions set the state of their
+// cells.
+func (g *Grid) applyInitialConditions() {
+	for n := range initialConditions {
+		e := &initialConditions[n]
+		switch e.kind {
+		case "focus":
+			disc := hexDiscCells(e.at[0], e.at[1], e.radius)
+			vN, dN := int(math.Round(e.v)), int(math.Round(e.d))
+			for k := 0; k < vN; k++ {
+				c := disc[rand.Intn(len(disc))]
+				g.localVirions[c[0]][c[1]]++
+			}
+			for k := 0; k < dN; k++ {
+				c := disc[rand.Intn(len(disc))]
+				g.localDips[c[0]][c[1]]++
+			}
+			if e.infected {
+				for _, c := range disc {
+					switch {
+					case vN > 0 && dN > 0:
+						g.state[c[0]][c[1]] = INFECTED_BOTH
+					case vN > 0:
+						g.state[c[0]][c[1]] = INFECTED_VIRION
+					case dN > 0:
+						g.state[c[0]][c[1]] = INFECTED_DIP
+					}
+				}
+			}
+			e.seededCells, e.seededV, e.seededD = len(disc), vN, dN
+		case "moi", "gradient":
+			for _, c := range realCells {
+				scale := 1.0
+				if e.kind == "gradient" {
+					scale = math.Exp(-float64(hexDistance(offsetToAxial(e.at[0], e.at[1]), offsetToAxial(c[0], c[1]))) / e.length)
+				}
+				vN, dN := poissonSample(e.v*scale), poissonSample(e.d*scale)
+				g.localVirions[c[0]][c[1]] += vN
+				g.localDips[c[0]][c[1]] += dN
+				if vN+dN > 0 {
+					e.seededCells++
+				}
+				e.seededV += vN
+				e.seededD += dN
+			}
+		case "antiviral", "dead":
+			state := ANTIVIRAL
+			if e.kind == "dead" {
+				state = DEAD
+			}
+			for _, c := range e.cells {
+				g.setCellState(c[0], c[1], state)
+			}
+			e.seededCells = len(e.cells)
+		}
+	}
+}
 
-	vInit := int(math.Round(*flag_v_pfu_initial))
-	dInit := int(math.Round(*flag_d_pfu_initial))
+// setCellState puts the cell at (i, j) into state at the start of a run, with the
+// timers of a cell that has just entered it
+func (g *Grid) setCellState(i, j, state int) {
+	switch state {
+	case ANTIVIRAL:
+		g.previousStates[i][j] = SUSCEPTIBLE
+		g.timeSinceAntiviral[i][j] = -2
+		g.antiviralDuration[i][j] = 0
+		if !g.antiviralFlag[i][j] {
+			g.antiviralFlag[i][j] = true
+			g.antiviralCellCount++
+		}
+	case DEAD:
+		g.timeSinceDead[i][j] = 0
+	case REGROWTH:
+		g.timeSinceRegrowth[i][j] = 0
+	}
+	g.state[i][j] = state
+}
 
-	switch option {
-	case 1:
-		if vInit > 0 {
-			g.localVirions[25][25] = vInit
-		} else {
-			fmt.Printf("v_pfu_initial < 0: %.2f\n", *flag_v_pfu_initial)
+// loadInitialState sets the grid from -initialState. A PNG is read at the hex centres,
+// each pixel taking the nearest state colour; it may be a bare grid image or one with the
+// infection graph above it. A CSV has a header and rows of i,j,state,virions,dips,ifn,
+// with the state as a name or number; cells it does not list stay susceptible. Cells
+// start their new state afresh, so infected cells lyse a full lysis time later.
+func (g *Grid) loadInitialState(path string) {
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open initial state: %v", err)
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		img, _, err := image.Decode(file)
+		if err != nil {
+			log.Fatalf("Failed to decode initial state %s: %v", path, err)
 		}
-		if dInit > 0 {
-			g.localDips[25][25] = dInit
-		} else {
-			fmt.Printf("d_pfu_initial < 0: %.2f\n", *flag_d_pfu_initial)
+		size := GRID_SIZE * CELL_SIZE * 2
+		b := img.Bounds()
+		if b.Dx() != size || b.Dy() < size {
+			log.Fatalf("Initial state %s is %dx%d, want a %dx%d grid image", path, b.Dx(), b.Dy(), size, size)
 		}
-	case 2:
-		if vInit > 0 && dInit > 0 {
-			g.state[25][25] = INFECTED_BOTH
-		} else if vInit > 0 {
-			g.state[25][25] = INFECTED_VIRION
-		} else if dInit > 0 {
-			g.state[25][25] = INFECTED_DIP
+		offset := b.Dy() - size // the infection graph above the grid
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				x, y := calculateHexCenter(i, j)
+				r, gr, bl, _ := img.At(b.Min.X+x, b.Min.Y+offset+y).RGBA()
+				state, best := -1, 3*40*40
+				for st, c := range stateColors {
+					dr, dg, db := int(r>>8)-int(c.R), int(gr>>8)-int(c.G), int(bl>>8)-int(c.B)
+					if d := dr*dr + dg*dg + db*db; d <= best {
+						state, best = st, d
+					}
+				}
+				if state < 0 {
+					log.Fatalf("Initial state %s: colour at cell (%d, %d) is not a state colour", path, i, j)
+				}
+				g.loadCell(path, i, j, state, 0, 0, 0)
+			}
 		}
-		g.localVirions[25][25] = vInit
-		g.localDips[25][25] = dInit
-
-	case 3:
-		for k := 0; k < vInit; k++ {
-			i := rand.Intn(GRID_SIZE)
-			j := rand.Intn(GRID_SIZE)
-			g.localVirions[i][j]++
+	} else {
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			log.Fatalf("Failed to read initial state %s: %v", path, err)
 		}
-		for k := 0; k < dInit; k++ {
-			i := rand.Intn(GRID_SIZE)
-			j := rand.Intn(GRID_SIZE)
-			g.localDips[i][j]++
+		for n, row := range records {
+			if n == 0 || len(row) == 0 {
+				continue // header
+			}
+			if len(row) != 6 {
+				log.Fatalf("Initial state %s, line %d: want i,j,state,virions,dips,ifn", path, n+1)
+			}
+			i, errI := strconv.Atoi(row[0])
+			j, errJ := strconv.Atoi(row[1])
+			v, errV := strconv.Atoi(row[3])
+			d, errD := strconv.Atoi(row[4])
+			ifn, errIFN := strconv.ParseFloat(row[5], 64)
+			state, errS := strconv.Atoi(row[2])
+			for k, name := range stateNames {
+				if strings.EqualFold(row[2], name) {
+					state, errS = k, nil
+				}
+			}
+			if errI != nil || errJ != nil || errV != nil || errD != nil || errIFN != nil || errS != nil ||
+				i < 0 || i >= GRID_SIZE || j < 0 || j >= GRID_SIZE || state < 0 || state >= len(stateNames) || v < 0 || d < 0 || ifn < 0 {
+				log.Fatalf("Initial state %s, line %d: invalid row %v", path, n+1, row)
+			}
+			g.loadCell(path, i, j, state, v, d, ifn)
 		}
 	}
+	total := 0.0
+	for _, c := range realCells {
+		total += g.IFNConcentration[c[0]][c[1]]
+	}
+	if total > 0 {
+		globalIFN = total
+	}
 }
 
-// Function to generate ticks dynamically
-func generateTicks(xMax float64, interval float64) []chart.Tick {
-	var ticks []chart.Tick
-	for value := 0.0; value <= xMax; value += interval {
-		label := fmt.Sprintf("%.0f", value) // Format the label as an integer
-		ticks = append(ticks, chart.Tick{
-			Value: value,
-			Label: label,
-		})
+// loadCell sets one cell of a loaded initial state, which must agree with the well mask
+func (g *Grid) loadCell(path string, i, j, state, v, d int, ifn float64) {
+	if (state == MASKED) != noCell[i][j] {
+		log.Fatalf("Initial state %s: cell (%d, %d) does not match the well mask; use the -wellMask of the saved run", path, i, j)
 	}
-	return ticks
+	if state != MASKED {
+		g.setCellState(i, j, state)
+	}
+	g.localVirions[i][j] = v
+	g.localDips[i][j] = d
+	g.IFNConcentration[i][j] = ifn
 }
 
-// Initialize the grid, setting all cells to SUSCEPTIBLE
-func (g *Grid) initialize() {
+// writeSnapshot saves the grid as snapshot_tNNN.csv (i,j,state,virions,dips,ifn) and
+// the matching states image snapshot_tNNN.png; either can start a run via -initialState
+func (g *Grid) writeSnapshot(outputFolder string, frameNum int) {
+	name := filepath.Join(outputFolder, fmt.Sprintf("snapshot_t%03d", frameNum))
+	file, err := os.Create(name + ".csv")
+	if err != nil {
+		log.Fatalf("Failed to create snapshot: %v", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"i", "j", "state", "virions", "dips", "ifn"})
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			g.state[i][j] = SUSCEPTIBLE
-			g.stateChanged[i][j] = false // Initialize as unchanged
-			g.timeSinceInfectVorBoth[i][j] = -1
-			g.timeSinceDead[i][j] = -1
-			g.timeSinceRegrowth[i][j] = -1
-			g.IFNConcentration[i][j] = 0
-			g.antiviralDuration[i][j] = -1
-			g.timeSinceSusceptible[i][j] = 0
-			g.previousStates[i][j] = -1
-			g.antiviralFlag[i][j] = false
-			g.timeSinceAntiviral[i][j] = -1
-			g.intraWT[i][j] = 0
-			g.intraDVG[i][j] = 0
-			g.lysisThreshold[i][j] = -1
+			writer.Write([]string{strconv.Itoa(i), strconv.Itoa(j), stateNames[g.state[i][j]],
+				strconv.Itoa(g.localVirions[i][j]), strconv.Itoa(g.localDips[i][j]),
+				strconv.FormatFloat(g.IFNConcentration[i][j], 'f', 6, 64)})
+		}
+	}
+	savePNGImage(g.gridToImage("states"), name+".png")
+}
+
+// writeInitialConditions records the -initialCondition elements and what each seeded
+// in initial_condition.csv
+func writeInitialConditions(outputFolder string) {
+	if len(initialConditions) == 0 {
+		return
+	}
+	file, err := os.Create(filepath.Join(outputFolder, "initial_condition.csv"))
+	if err != nil {
+		log.Fatalf("Failed to create initial condition CSV file: %v", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"element", "kind", "spec", "cells", "virions", "DIPs"})
+	for n, e := range initialConditions {
+		writer.Write([]string{strconv.Itoa(n + 1), e.kind, e.spec, strconv.Itoa(e.seededCells), strconv.Itoa(e.seededV), strconv.Itoa(e.seededD)})
+	}
+}
+
+// loadConfig sets the flags listed in the -config file of fs that were not given on the
+// command line. Lines are "key = value" (a leading '-' on the key is allowed); blank
+// lines and lines starting with '#' are skipped, and a key on several lines is joined
+// with ';', so list specs such as -initialCondition can take one element per line.
+func loadConfig(fs *flag.FlagSet) {
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	values := map[string]string{}
+	var keys []string
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimLeft(strings.TrimSpace(key), "-"), strings.TrimSpace(value)
+		if !ok || fs.Lookup(key) == nil || key == "config" {
+			log.Fatalf("%s:%d: unknown setting %q", path, n+1, line)
+		}
+		if previous, seen := values[key]; seen {
+			values[key] = previous + ";" + value
+			continue
+		}
+		values[key] = value
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if given[key] {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			log.Fatalf("%s: invalid value for %s: %v", path, key, err)
+		}
+	}
+}
+
+// saveRunConfig writes every flag of the run to run_config.txt, which -config can load
+// to repeat the run
+func saveRunConfig(outputFolder string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Settings of this run; repeat it with -config=run_config.txt\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			fmt.Fprintf(&b, "%s = %s\n", f.Name, f.Value.String())
+		}
+	})
+	if err := os.WriteFile(filepath.Join(outputFolder, "run_config.txt"), []byte(b.String()), 0644); err != nil {
+		log.Fatalf("Failed to write run config: %v", err)
+	}
+}
 
+// parseIntList parses n colon-separated integers, e.g. "25:25:8"
+func parseIntList(value string, n int, context string) []int {
+	parts := strings.Split(value, ":")
+	if len(parts) != n {
+		log.Fatalf("Expected %d values separated by ':' in %q", n, context)
+	}
+	v := make([]int, n)
+	for k, p := range parts {
+		x, err := strconv.Atoi(p)
+		if err != nil {
+			log.Fatalf("Invalid integer %q in %q", p, context)
 		}
+		v[k] = x
+	}
+	return v
+}
+
+// IFN species with its own range, decay, production and potency.
+// radius 0 spreads the production uniformly over the whole well.
+type ifnSpecies struct {
+	name     string
+	radius   int     // spread radius in cells
+	halfLife float64 // half-life in hours, 0 disables decay
+	prodV    float64 // production per hour of an INFECTED_VIRION cell
+	prodD    float64 // production per hour of an INFECTED_DIP cell
+	prodBoth float64 // production per hour of an INFECTED_BOTH cell
+	potency  float64 // antiviral potency, weight of the species in the IFN signal
+}
+
+// parseIFNSpecies parses the -ifnSpecies spec
+func parseIFNSpecies(spec string) []ifnSpecies {
+	var list []ifnSpecies
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, params, found := strings.Cut(entry, ":")
+		if !found || name == "" {
+			log.Fatalf("Invalid IFN species %q: expected name:key=value,...", entry)
+		}
+		s := ifnSpecies{name: name, potency: 1.0}
+		for _, kv := range strings.Split(params, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				log.Fatalf("Invalid IFN species parameter %q in %q", kv, entry)
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				log.Fatalf("Invalid value for %s in IFN species %q: %v", key, name, err)
+			}
+			switch key {
+			case "radius":
+				s.radius = int(v)
+			case "halfLife":
+				s.halfLife = v
+			case "prodV":
+				s.prodV = v
+			case "prodD":
+				s.prodD = v
+			case "prodBoth":
+				s.prodBoth = v
+			case "potency":
+				s.potency = v
+			default:
+				log.Fatalf("Unknown IFN species parameter %q in %q", key, entry)
+			}
+		}
+		if s.radius < 0 {
+			log.Fatalf("IFN species %q: radius must be >= 0", name)
+		}
+		for _, other := range list {
+			if other.name == s.name {
+				log.Fatalf("Duplicate IFN species %q", name)
+			}
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// Cell-type profile. tau gates IFN production and the antiviral response like TAU,
+// ifn scales IFN production, rho is the per-particle infection chance and lysis the
+// mean lysis time (non-legacy lysis distributions are scaled by lysis/-meanLysisTime).
+type cellProfile struct {
+	name         string
+	tau          int
+	antiviralTAU int // tau, or -ifnResponseTau for tau = 0 when exogenous IFN is dosed
+	ifn          float64
+	rho          float64
+	lysis        float64
+}
+
+var cellProfiles []cellProfile
+
+// parseCellProfiles reads the -cellTypes spec; an empty spec gives one profile built
+// from the global parameters
+func parseCellProfiles(spec string) []cellProfile {
+	base := cellProfile{name: "default", tau: TAU, ifn: 1, rho: RHO, lysis: MEAN_LYSIS_TIME}
+	var list []cellProfile
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, params, found := strings.Cut(entry, ":")
+		if name == "" {
+			log.Fatalf("Invalid cell type %q: expected name:key=value,...", entry)
+		}
+		c := base
+		c.name = name
+		if found {
+			for _, kv := range strings.Split(params, ",") {
+				key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+				if !ok {
+					log.Fatalf("Invalid cell type parameter %q in %q", kv, entry)
+				}
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil || v < 0 {
+					log.Fatalf("Invalid value for %s in cell type %q: want a number >= 0", key, name)
+				}
+				switch key {
+				case "tau":
+					c.tau = int(v)
+				case "ifn":
+					c.ifn = v
+				case "rho":
+					c.rho = v
+				case "lysis":
+					c.lysis = v
+				default:
+					log.Fatalf("Unknown cell type parameter %q in %q", key, entry)
+				}
+			}
+		}
+		for _, other := range list {
+			if other.name == c.name {
+				log.Fatalf("Duplicate cell type %q", name)
+			}
+		}
+		list = append(list, c)
+	}
+	if len(list) == 0 {
+		list = append(list, base)
+	}
+	for k := range list {
+		list[k].antiviralTAU = list[k].tau
+		if list[k].tau == 0 && len(ifnDoses) > 0 {
+			list[k].antiviralTAU = *flag_ifnResponseTau
+		}
+	}
+	return list
+}
+
+// profile returns the cell-type profile of the cell at (i, j)
+func (g *Grid) profile(i, j int) *cellProfile {
+	return &cellProfiles[g.cellType[i][j]]
+}
+
+// assignCellTypes places the cell types over the grid according to -cellTypeLayout
+func (g *Grid) assignCellTypes(spec string) {
+	n := len(cellProfiles)
+	if n == 1 {
+		return
+	}
+	kind, args, _ := strings.Cut(spec, ":")
+	var params []float64
+	if args != "" && (kind == "ratio" || kind == "stripes" || kind == "checker" || kind == "islands") {
+		for _, a := range strings.Split(args, ":") {
+			v, err := strconv.ParseFloat(a, 64)
+			if err != nil || v < 0 {
+				log.Fatalf("Invalid cell type layout %q: parameters must be numbers >= 0", spec)
+			}
+			params = append(params, v)
+		}
+	}
+	switch kind {
+	case "", "ratio":
+		weights := params
+		if len(weights) == 0 {
+			for k := 0; k < n; k++ {
+				weights = append(weights, 1)
+			}
+		}
+		total := 0.0
+		for _, w := range weights {
+			total += w
+		}
+		if len(weights) != n || total <= 0 {
+			log.Fatalf("Cell type layout %q needs %d weights with a positive sum", spec, n)
+		}
+		for _, c := range realCells {
+			x := rand.Float64() * total
+			k := 0
+			for k < n-1 && x >= weights[k] {
+				x -= weights[k]
+				k++
+			}
+			g.cellType[c[0]][c[1]] = k
+		}
+	case "stripes", "checker":
+		if len(params) != 1 || params[0] < 1 {
+			log.Fatalf("Cell type layout %q needs one width >= 1", spec)
+		}
+		w := int(params[0])
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				if kind == "stripes" {
+					g.cellType[i][j] = (i / w) % n
+				} else {
+					g.cellType[i][j] = (i/w + j/w) % n
+				}
+			}
+		}
+	case "islands":
+		if len(params) != 2 {
+			log.Fatalf("Cell type layout %q: want islands:radius:count", spec)
+		}
+		// Discs of the first type at random centres on a background of the last type
+		spacing := float64(CELL_SIZE) * math.Sqrt(3)
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.cellType[i][j] = n - 1
+			}
+		}
+		for k := 0; k < int(params[1]); k++ {
+			ci, cj := randomCell()
+			cx, cy := hexToPixel(ci, cj)
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					x, y := hexToPixel(i, j)
+					if math.Hypot(x-cx, y-cy)/spacing <= params[0] {
+						g.cellType[i][j] = 0
+					}
+				}
+			}
+		}
+	default:
+		file, err := os.Open(spec)
+		if err != nil {
+			log.Fatalf("Failed to open cell type layout: %v", err)
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to decode cell type layout %s: %v", spec, err)
+		}
+		// Same stretching as -wellMask; the grey range is split into one band per type
+		b := img.Bounds()
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				px := b.Min.X + (2*i+1)*b.Dx()/(2*GRID_SIZE)
+				py := b.Min.Y + (2*j+1)*b.Dy()/(2*GRID_SIZE)
+				g.cellType[i][j] = int(color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y) * n / 256
+			}
+		}
+	}
+	for k, c := range cellProfiles {
+		cells := 0
+		for _, rc := range realCells {
+			if g.cellType[rc[0]][rc[1]] == k {
+				cells++
+			}
+		}
+		fmt.Printf("  Cell type %s: %d cells, tau %d, ifn %.2f, rho %.4f, lysis %.2f\n", c.name, cells, c.tau, c.ifn, c.rho, c.lysis)
+	}
+}
+
+// antiviralScale stretches non-legacy antiviral delays by the type's response time
+func (c *cellProfile) antiviralScale() float64 {
+	if antiviralTAU <= 0 {
+		return 1
+	}
+	return float64(c.antiviralTAU) / float64(antiviralTAU)
+}
+
+// cellTypeCounts returns, per cell type, the cells in each state
+func (g *Grid) cellTypeCounts() [][]int {
+	counts := make([][]int, len(cellProfiles))
+	for k := range counts {
+		counts[k] = make([]int, MASKED)
+	}
+	for _, c := range realCells {
+		counts[g.cellType[c[0]][c[1]]][g.state[c[0]][c[1]]]++
+	}
+	return counts
+}
+
+// Virus strain. rho is the per-particle infection chance (scaled by the cell type's rho
+// relative to -rho), burst the virion burst size, lysis the mean lysis time and ifn a
+// factor on the IFN produced by cells it infects; share is its part of the inoculum.
+type virusStrain struct {
+	name  string
+	rho   float64
+	burst int
+	lysis float64
+	ifn   float64
+	share float64
+	color color.RGBA
+}
+
+var (
+	strains           []virusStrain // empty: a single unlabelled virus
+	strainCoinfection string        // "first", "split" or "replace"
+)
+
+var strainPalette = []color.RGBA{
+	{255, 0, 0, 255}, {255, 140, 0, 255}, {255, 0, 255, 255}, {0, 255, 255, 255},
+	{255, 255, 255, 255}, {255, 105, 180, 255}, {139, 69, 19, 255}, {154, 205, 50, 255},
+}
+
+// parseStrains reads the -strains spec
+func parseStrains(spec string) []virusStrain {
+	var list []virusStrain
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, params, found := strings.Cut(entry, ":")
+		if name == "" {
+			log.Fatalf("Invalid strain %q: expected name:key=value,...", entry)
+		}
+		st := virusStrain{name: name, rho: RHO, burst: BURST_SIZE_V, lysis: MEAN_LYSIS_TIME, ifn: 1, share: 1,
+			color: strainPalette[len(list)%len(strainPalette)]}
+		if found {
+			for _, kv := range strings.Split(params, ",") {
+				key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+				if !ok {
+					log.Fatalf("Invalid strain parameter %q in %q", kv, entry)
+				}
+				if key == "color" {
+					rgb, err := strconv.ParseUint(strings.TrimPrefix(value, "#"), 16, 32)
+					if err != nil || len(strings.TrimPrefix(value, "#")) != 6 {
+						log.Fatalf("Invalid color %q for strain %q: want RRGGBB", value, name)
+					}
+					st.color = color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}
+					continue
+				}
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil || v < 0 {
+					log.Fatalf("Invalid value for %s in strain %q: want a number >= 0", key, name)
+				}
+				switch key {
+				case "rho":
+					st.rho = v
+				case "burst":
+					st.burst = int(v)
+				case "lysis":
+					st.lysis = v
+				case "ifn":
+					st.ifn = v
+				case "share":
+					st.share = v
+				default:
+					log.Fatalf("Unknown strain parameter %q in %q", key, entry)
+				}
+			}
+		}
+		for _, other := range list {
+			if other.name == st.name {
+				log.Fatalf("Duplicate strain %q", name)
+			}
+		}
+		list = append(list, st)
+	}
+	if len(list) > 32 {
+		log.Fatalf("At most 32 strains are supported, got %d", len(list))
+	}
+	return list
+}
+
+// strainsOf lists the strains infecting the cell at (i, j)
+func (g *Grid) strainsOf(i, j int) []int {
+	var in []int
+	for k := range strains {
+		if g.strainMask[i][j]&(1<<k) != 0 {
+			in = append(in, k)
+		}
+	}
+	return in
+}
+
+// strainMean averages a strain parameter over the strains infecting (i, j); def is
+// returned for cells without a strain
+func (g *Grid) strainMean(i, j int, def float64, value func(st *virusStrain) float64) float64 {
+	in := g.strainsOf(i, j)
+	if len(in) == 0 {
+		return def
+	}
+	total := 0.0
+	for _, k := range in {
+		total += value(&strains[k])
+	}
+	return total / float64(len(in))
+}
+
+// lysisMean is the mean lysis time of the cell at (i, j): its type's lysis time,
+// stretched by its strains' lysis time relative to -meanLysisTime
+func (g *Grid) lysisMean(i, j int) float64 {
+	lysis := g.profile(i, j).lysis
+	if len(strains) > 0 && MEAN_LYSIS_TIME > 0 {
+		lysis *= g.strainMean(i, j, MEAN_LYSIS_TIME, func(st *virusStrain) float64 { return st.lysis }) / MEAN_LYSIS_TIME
+	}
+	return lysis
+}
+
+// ifnScale is the IFN production factor of the cell at (i, j): its type's ifn times
+// that of its strains
+func (g *Grid) ifnScale(i, j int) float64 {
+	return g.profile(i, j).ifn * g.strainMean(i, j, 1, func(st *virusStrain) float64 { return st.ifn })
+}
+
+// strainBurst is the virion burst size of the cell at (i, j), averaged over its strains
+func (g *Grid) strainBurst(i, j int) int {
+	if len(strains) == 0 {
+		return BURST_SIZE_V
+	}
+	return int(math.Round(g.strainMean(i, j, float64(BURST_SIZE_V), func(st *virusStrain) float64 { return float64(st.burst) })))
+}
+
+// strainHazards returns each strain's infection hazard at (i, j) for a cell whose
+// per-particle infection chance at -rho is perParticle
+func (g *Grid) strainHazards(i, j int, perParticle float64) []float64 {
+	hazards := make([]float64, len(strains))
+	for k, st := range strains {
+		pp := 0.0
+		if RHO > 0 {
+			pp = math.Min(1, perParticle*st.rho/RHO)
+		}
+		if n := g.strainVirions[k][i][j]; n > 0 {
+			if pp >= 1 {
+				hazards[k] = math.Inf(1)
+			} else {
+				hazards[k] = -float64(n) * math.Log1p(-pp)
+			}
+		}
+	}
+	return hazards
+}
+
+// virionInfectionProbability is the chance that the virions at (i, j) infect the cell
+func (g *Grid) virionInfectionProbability(i, j int, perParticle float64) float64 {
+	if len(strains) == 0 {
+		return 1 - math.Pow(1-perParticle, float64(g.localVirions[i][j]))
+	}
+	total := 0.0
+	for _, h := range g.strainHazards(i, j, perParticle) {
+		total += h
+	}
+	return 1 - math.Exp(-total)
+}
+
+// infectStrain labels a virion infection of the cell at (i, j) with a strain drawn in
+// proportion to the strains' hazards, mirrors particle uptake in the strain fields and
+// applies -strainCoinfection to cells that already carry a strain. changed tells
+// whether the infection changed the cell's state (and so took up particles).
+func (g *Grid) infectStrain(i, j int, byVirion bool, perParticle float64, changed bool) {
+	if len(strains) == 0 || !byVirion {
+		return
+	}
+	hazards := g.strainHazards(i, j, perParticle)
+	total := 0.0
+	for _, h := range hazards {
+		total += h
+	}
+	k := 0
+	if math.IsInf(total, 1) {
+		for hazards[k] != total {
+			k++
+		}
+	} else {
+		x := rand.Float64() * total
+		for k < len(hazards)-1 && (x >= hazards[k] || hazards[k] == 0) {
+			x -= hazards[k]
+			k++
+		}
+	}
+	if changed {
+		switch particleUptake {
+		case "infecting":
+			g.strainVirions[k][i][j]--
+		case "all":
+			for s := range strains {
+				g.strainVirions[s][i][j] = 0
+			}
+		}
+	}
+	bit := uint32(1) << k
+	switch {
+	case g.strainMask[i][j] == 0:
+		g.strainMask[i][j] = bit
+	case g.strainMask[i][j]&bit != 0 || strainCoinfection == "first":
+	case !changed && g.excludesSuperinfection(i, j):
+	case strainCoinfection == "split":
+		g.strainMask[i][j] |= bit
+	case strainCoinfection == "replace":
+		g.strainMask[i][j] = bit
+	}
+}
+
+// spreadStrainVirions releases burstV virions from (i, j), split over the cell's
+// strains in proportion to their burst sizes
+func (g *Grid) spreadStrainVirions(i, j, burstV int) {
+	in := g.strainsOf(i, j)
+	if len(in) == 0 {
+		in = []int{0}
+	}
+	weight := 0.0
+	for _, k := range in {
+		weight += float64(strains[k].burst)
+	}
+	left := burstV
+	for n, k := range in {
+		share := left
+		if n < len(in)-1 && weight > 0 {
+			share = int(float64(burstV) * float64(strains[k].burst) / weight)
+		}
+		left -= share
+		g.spreadParticles(i, j, share, virionSpread, g.neighborsRingVirion[i][j], &g.localVirions, &g.virionLedger, &g.totalRandomJumpVirions, &g.strainVirions[k])
+	}
+}
+
+// seedStrainInoculum splits the inoculum virions over the strains by their shares and
+// labels cells infected at the start with the strains of their virions
+func (g *Grid) seedStrainInoculum() {
+	if len(strains) == 0 {
+		return
+	}
+	total := 0.0
+	for _, st := range strains {
+		total += st.share
+	}
+	if total <= 0 {
+		log.Fatalf("Strain shares must have a positive sum")
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			for n := 0; n < g.localVirions[i][j]; n++ {
+				x := rand.Float64() * total
+				k := 0
+				for k < len(strains)-1 && x >= strains[k].share {
+					x -= strains[k].share
+					k++
+				}
+				g.strainVirions[k][i][j]++
+				if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
+					g.strainMask[i][j] |= 1 << k
+				}
+			}
+		}
+	}
+}
+
+// decayStrainVirions applies the virion decay factor to each strain at (i, j) and
+// resets the total to their sum
+func (g *Grid) decayStrainVirions(i, j int, factor float64) {
+	g.localVirions[i][j] = 0
+	for k := range strains {
+		g.strainVirions[k][i][j] = int(math.Floor(float64(g.strainVirions[k][i][j])*factor + 0.5))
+		g.localVirions[i][j] += g.strainVirions[k][i][j]
+	}
+}
+
+// strainCounts returns the virions on the grid and the infected cells of each strain
+func (g *Grid) strainCounts() ([]int, []int) {
+	virions := make([]int, len(strains))
+	infected := make([]int, len(strains))
+	for k := range strains {
+		virions[k] = sumCounts(&g.strainVirions[k])
+	}
+	for _, c := range realCells {
+		if st := g.state[c[0]][c[1]]; st == INFECTED_VIRION || st == INFECTED_BOTH {
+			for _, k := range g.strainsOf(c[0], c[1]) {
+				infected[k]++
+			}
+		}
+	}
+	return virions, infected
+}
+
+// DIP variant. interference is the fraction by which it cuts the virion burst of a
+// co-infected cell, advantage its DIP yield relative to BURST_SIZE_D and share its part
+// of the DIP inoculum. De novo variants record the variant they arose from and when.
+type dipVariant struct {
+	name         string
+	interference float64
+	advantage    float64
+	share        float64
+	parent       string
+	born         int
+}
+
+const (
+	maxDIPVariants = 64  // one bit per variant in dipVariantMask
+	deNovoSpread   = 0.3 // log-scale sd of a de novo variant's traits around its parent's
+)
+
+var (
+	dipVariants      []dipVariant // empty: one homogeneous DIP
+	dipDeNovoRate    float64
+	dipVariantWriter *csv.Writer // dip_variants.csv; nil without variants
+)
+
+// parseDIPVariants reads the -dipVariants spec. De novo generation without variants
+// starts from a single ancestral variant with the legacy DIP behaviour.
+func parseDIPVariants(spec string, deNovo bool) []dipVariant {
+	var list []dipVariant
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, params, found := strings.Cut(entry, ":")
+		if name == "" {
+			log.Fatalf("Invalid DIP variant %q: expected name:key=value,...", entry)
+		}
+		v := dipVariant{name: name, advantage: 1, share: 1, parent: "inoculum"}
+		if found {
+			for _, kv := range strings.Split(params, ",") {
+				key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+				if !ok {
+					log.Fatalf("Invalid DIP variant parameter %q in %q", kv, entry)
+				}
+				x, err := strconv.ParseFloat(value, 64)
+				if err != nil || x < 0 {
+					log.Fatalf("Invalid value for %s in DIP variant %q: want a number >= 0", key, name)
+				}
+				switch key {
+				case "interference":
+					if x > 1 {
+						log.Fatalf("Interference of DIP variant %q must be in [0, 1]", name)
+					}
+					v.interference = x
+				case "advantage":
+					v.advantage = x
+				case "share":
+					v.share = x
+				default:
+					log.Fatalf("Unknown DIP variant parameter %q in %q", key, entry)
+				}
+			}
+		}
+		for _, other := range list {
+			if other.name == v.name {
+				log.Fatalf("Duplicate DIP variant %q", name)
+			}
+		}
+		list = append(list, v)
+	}
+	if len(list) == 0 && deNovo {
+		list = append(list, dipVariant{name: "D0", advantage: 1, share: 1, parent: "inoculum"})
+	}
+	if len(list) > maxDIPVariants {
+		log.Fatalf("At most %d DIP variants are supported, got %d", maxDIPVariants, len(list))
+	}
+	return list
+}
+
+// dipVariantsOf lists the DIP variants infecting the cell at (i, j)
+func (g *Grid) dipVariantsOf(i, j int) []int {
+	var in []int
+	for k := range dipVariants {
+		if g.dipVariantMask[i][j]&(1<<k) != 0 {
+			in = append(in, k)
+		}
+	}
+	return in
+}
+
+// dipVariantYield returns the factors on the virion and DIP bursts of the cell at
+// (i, j): one minus the mean interference and the mean advantage of its variants
+func (g *Grid) dipVariantYield(i, j int) (float64, float64) {
+	in := g.dipVariantsOf(i, j)
+	if len(in) == 0 {
+		return 1, 1
+	}
+	interference, advantage := 0.0, 0.0
+	for _, k := range in {
+		interference += dipVariants[k].interference
+		advantage += dipVariants[k].advantage
+	}
+	return 1 - interference/float64(len(in)), advantage / float64(len(in))
+}
+
+// infectDIPVariant labels a DIP infection of the cell at (i, j) with a variant drawn in
+// proportion to the variants' particles there and mirrors particle uptake in the
+// variant fields. changed tells whether the infection changed the cell's state.
+func (g *Grid) infectDIPVariant(i, j int, byDip bool, changed bool) {
+	if len(dipVariants) == 0 || !byDip {
+		return
+	}
+	// Particle uptake has already been applied to localDips, so draw from the variants
+	total := 0
+	for v := range dipVariants {
+		total += g.dipVariantDips[v][i][j]
+	}
+	k := 0
+	if total > 0 {
+		x := rand.Intn(total)
+		for x >= g.dipVariantDips[k][i][j] {
+			x -= g.dipVariantDips[k][i][j]
+			k++
+		}
+	}
+	if changed {
+		switch particleUptake {
+		case "infecting":
+			if g.dipVariantDips[k][i][j] > 0 {
+				g.dipVariantDips[k][i][j]--
+			}
+		case "all":
+			for v := range dipVariants {
+				g.dipVariantDips[v][i][j] = 0
+			}
+		}
+	} else if g.excludesSuperinfection(i, j) {
+		return
+	}
+	g.dipVariantMask[i][j] |= 1 << k
+}
+
+// generateDIPVariant lets virion replication in the cell at (i, j) produce a new DIP
+// variant with probability 1 - exp(-dipDeNovoRate * burstV). The variant derives its
+// traits from one of the cell's variants (or the first variant) and joins the cell, so
+// it takes its share of the DIPs the cell releases.
+func (g *Grid) generateDIPVariant(i, j, burstV int) {
+	if dipDeNovoRate <= 0 || burstV <= 0 || len(dipVariants) >= maxDIPVariants ||
+		rand.Float64() >= 1-math.Exp(-dipDeNovoRate*float64(burstV)) {
+		return
+	}
+	parent := 0
+	if in := g.dipVariantsOf(i, j); len(in) > 0 {
+		parent = in[rand.Intn(len(in))]
+	}
+	p := dipVariants[parent]
+	v := dipVariant{
+		name:         fmt.Sprintf("dn%d", len(dipVariants)),
+		interference: math.Min(1, p.interference*math.Exp(rand.NormFloat64()*deNovoSpread)),
+		advantage:    p.advantage * math.Exp(rand.NormFloat64()*deNovoSpread),
+		parent:       p.name,
+		born:         g.frameNum,
+	}
+	if p.interference == 0 {
+		v.interference = rand.Float64() * deNovoSpread
+	}
+	dipVariants = append(dipVariants, v)
+	g.dipVariantDips = append(g.dipVariantDips, [GRID_SIZE][GRID_SIZE]int{})
+	g.dipVariantMask[i][j] |= 1 << (len(dipVariants) - 1)
+}
+
+// spreadDIPVariants releases burstD DIPs from (i, j), split over the cell's variants in
+// proportion to their advantages; DIPs of a cell without a variant belong to the first
+func (g *Grid) spreadDIPVariants(i, j, burstD int) {
+	in := g.dipVariantsOf(i, j)
+	if len(in) == 0 {
+		in = []int{0}
+	}
+	weight := 0.0
+	for _, k := range in {
+		weight += dipVariants[k].advantage
+	}
+	left := burstD
+	for n, k := range in {
+		share := left
+		if n < len(in)-1 && weight > 0 {
+			share = int(float64(burstD) * dipVariants[k].advantage / weight)
+		}
+		left -= share
+		g.spreadParticles(i, j, share, dipSpread, g.neighborsRingDIP[i][j], &g.localDips, &g.dipLedger, &g.totalRandomJumpDIPs, &g.dipVariantDips[k])
+	}
+}
+
+// seedDIPVariantInoculum splits the inoculum DIPs over the variants by their shares and
+// labels cells infected at the start with the variants of their DIPs
+func (g *Grid) seedDIPVariantInoculum() {
+	if len(dipVariants) == 0 {
+		return
+	}
+	total := 0.0
+	for _, v := range dipVariants {
+		total += v.share
+	}
+	if total <= 0 {
+		log.Fatalf("DIP variant shares must have a positive sum")
+	}
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			for n := 0; n < g.localDips[i][j]; n++ {
+				x := rand.Float64() * total
+				k := 0
+				for k < len(dipVariants)-1 && x >= dipVariants[k].share {
+					x -= dipVariants[k].share
+					k++
+				}
+				g.dipVariantDips[k][i][j]++
+				if g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_BOTH {
+					g.dipVariantMask[i][j] |= 1 << k
+				}
+			}
+		}
+	}
+}
+
+// decayDIPVariants applies the DIP decay factor to each variant at (i, j) and resets
+// the total to their sum
+func (g *Grid) decayDIPVariants(i, j int, factor float64) {
+	g.localDips[i][j] = 0
+	for k := range dipVariants {
+		g.dipVariantDips[k][i][j] = int(math.Floor(float64(g.dipVariantDips[k][i][j])*factor + 0.5))
+		g.localDips[i][j] += g.dipVariantDips[k][i][j]
+	}
+}
+
+// dipVariantCounts returns the DIPs on the grid and the infected cells of each variant
+func (g *Grid) dipVariantCounts() ([]int, []int) {
+	dips := make([]int, len(dipVariants))
+	infected := make([]int, len(dipVariants))
+	for k := range dipVariants {
+		dips[k] = sumCounts(&g.dipVariantDips[k])
+	}
+	for _, c := range realCells {
+		if st := g.state[c[0]][c[1]]; st == INFECTED_DIP || st == INFECTED_BOTH {
+			for _, k := range g.dipVariantsOf(c[0], c[1]) {
+				infected[k]++
+			}
+		}
+	}
+	return dips, infected
+}
+
+// recordDIPVariants appends one row per DIP variant to dip_variants.csv and returns
+// the number of variants that still have particles or infected cells
+func (g *Grid) recordDIPVariants(writer *csv.Writer, frameNum int) int {
+	dips, infected := g.dipVariantCounts()
+	alive := 0
+	for k, v := range dipVariants {
+		if dips[k] > 0 || infected[k] > 0 {
+			alive++
+		}
+		if writer != nil {
+			writer.Write([]string{
+				strconv.Itoa(frameNum), v.name, v.parent, strconv.Itoa(v.born),
+				strconv.FormatFloat(v.interference, 'f', 4, 64), strconv.FormatFloat(v.advantage, 'f', 4, 64),
+				strconv.Itoa(dips[k]), strconv.Itoa(infected[k]),
+			})
+		}
+	}
+	return alive
+}
+
+// DIP related
+var (
+	dipOption bool // true to enable DIP, false to disable DIP
+
+	// When DIP is enabled, default DIP-related ratios remain default; when disabled, set to 0
+	D_only_IFN_stimulate_ratio float64 = 5.0 * ifnBothFold
+	BOTH_IFN_stimulate_ratio   float64 = 10.0 * ifnBothFold
+)
+
+// Global variables
+var (
+	// particleSpreadOption  = "jumpradius" // options: "celltocell", "jumprandomly", "jumpradius"
+	// PartionParticleSpreadOption = false // options: "true" or "false"
+
+	//ifnSpreadOption = "global" // options: "global", "local" or "noIFN"
+	//dipOption =
+
+	BURST_SIZE_V  int    // CHANGE 50 Number of virions released when a cell lyses
+	BURST_SIZE_D  int    // CHANGE 100 // Number of DIPs released when a cell lyses
+	VStimulateIFN = true // CHANGE if false then usually only DIP stimulate IFN in this situlation, not virion
+	//jumpRandomly          = true // CHANGE
+	//jumpRadiusV           = 0    // CHANGE Virion jump radius
+	//jumpRadiusD           = 0    // CHANGE DIP jump radius
+	//IFN_wave_radius       = 10   // CHANGE 10
+	// this is true only when jumpRandomly is true
+
+	TAU         int // 95
+	ifnBothFold = 1.0
+	//D_only_IFN_stimulate_ratio = 5.0 * ifnBothFold  // D/V *R *D_only_IFN_stimulate_ratio
+	//BOTH_IFN_stimulate_ratio = 10.0 * ifnBothFold // D/V *R *D_only_IFN_stimulate_ratio
+
+	// option    = 2        // Option for infection initialization
+	//videotype = "states" // "states" // color in "states" or "IFNconcentration" or "IFNonlyLargerThanZero" or "antiviralState" or "particles"
+	RHO    float64 //0.026    //0.02468  // 0.09 Infection rate constant
+	option int
+	// radius 10 of grid has 331 cells
+	R int
+	// radius 10 of grid has 331 cells, originally infected cell increases R IFN,
+	ALPHA = 1.0 // Parameter for infection probability (set to 1.5)
+
+	REGROWTH_MEAN       = 24.0  // Mean time for regrowth
+	REGROWTH_STD        = 6.0   // Standard deviation for regrowth time
+	MEAN_LYSIS_TIME     float64 // Mean lysis time
+	STANDARD_LYSIS_TIME float64 // Standard deviation for lysis time
+	maxGlobalIFN        = -1.0  // used to track maximum IFN value
+	globalIFN           = -1.0  // global IFN concentration
+	globalIFNperCell    = 0.0
+	IFN_DELAY           = 5
+	STD_IFN_DELAY       = 1
+
+	// allowVirionJump = jumpRadiusV > 0 || jumpRandomly // Allow virions to jump to other cells
+	// allowDIPJump = jumpRadiusD > 0 || jumpRandomly // Allow DIPs to jump to other cells
+	allowVirionJump bool
+	allowDIPJump    bool
+	//ifnWave = IFN_wave_radius > 0
+
+	yMax          float64
+	xMax          = float64(TIME_STEPS)
+	ticksInterval float64 // Interval for X-axis ticks
+
+	adjusted_DIP_IFN_stimulate   float64
+	perParticleInfectionChance_V float64
+	totalDeadFromBoth            int
+	totalDeadFromV               int
+	virionDiffusionRate          int
+	dipDiffusionRate             int
+
+	virion_half_life float64 //= 0.0 // 3.2 // ~4 d^-1 => half-life ~4.2 hours
+	dip_half_life    float64 //= 0.0 // 3.2 // ~4 d^-1 => half-life ~4.2 hours
+	ifn_half_life    float64 //= 0.0 // 3.0 // ~3 d^-1 => half-life ~5.5 hours
+	videotype        string
+	dipAdvantage     float64 // DIP advantage = burstSizeD / burstSizeV
+)
+
+// Cell state definitions
+const (
+	SUSCEPTIBLE     = 0 // Susceptible state
+	INFECTED_VIRION = 1 // Infected by virion
+	INFECTED_DIP    = 5 // Infected by DIP
+	INFECTED_BOTH   = 6 // Infected by both virion and DIP
+	DEAD            = 2 // Dead state
+	ANTIVIRAL       = 3 // Antiviral state
+	REGROWTH        = 4 // Regrowth state
+	MASKED          = 7 // No cell at this site (outside the well mask)
+)
+
+// Grid structure for storing the simulation state
+type Grid struct {
+	state                  [GRID_SIZE][GRID_SIZE]int       // State of the cells in the grid
+	localVirions           [GRID_SIZE][GRID_SIZE]int       // Number of virions in each cell
+	localDips              [GRID_SIZE][GRID_SIZE]int       // Number of DIPs in each cell
+	IFNConcentration       [GRID_SIZE][GRID_SIZE]float64   // IFN concentration in each cell
+	timeSinceInfectVorBoth [GRID_SIZE][GRID_SIZE]int       // Time since infection for each cell
+	timeSinceInfectDIP     [GRID_SIZE][GRID_SIZE]int       // Time since infection for each cell
+	timeSinceDead          [GRID_SIZE][GRID_SIZE]int       // Time since death for each cell
+	timeSinceRegrowth      [GRID_SIZE][GRID_SIZE]int       // Time since regrowth for each cell
+	timeSinceSusceptible   [GRID_SIZE][GRID_SIZE]int       // Time since cell became susceptible
+	neighbors1             [GRID_SIZE][GRID_SIZE][6][2]int // Neighbors at distance 1
+	neighbors2             [GRID_SIZE][GRID_SIZE][6][2]int // Neighbors at distance 2
+	neighbors3             [GRID_SIZE][GRID_SIZE][6][2]int // Neighbors at distance 3
+	neighborsRingVirion    [GRID_SIZE][GRID_SIZE][][2]int  // Virion jump targets within jumpRadiusV
+	neighborsRingDIP       [GRID_SIZE][GRID_SIZE][][2]int  // DIP jump targets within jumpRadiusD
+	neighborsIFNArea       [GRID_SIZE][GRID_SIZE][][2]int  // Neighbors within IFN wave radius
+	stateChanged           [GRID_SIZE][GRID_SIZE]bool      // Flag to indicate if the state of a cell has changed
+	antiviralDuration      [GRID_SIZE][GRID_SIZE]int       // Duration of antiviral state
+	previousStates         [GRID_SIZE][GRID_SIZE]int       // Previous state of the cell
+	antiviralFlag          [GRID_SIZE][GRID_SIZE]bool      // Flag to indicate if the cell is in the antiviral state
+	timeSinceAntiviral     [GRID_SIZE][GRID_SIZE]int       // Time since the cell entered the antiviral state
+	antiviralCellCount     int                             // Number of cells in the antiviral state
+	totalAntiviralTime     int
+	intraWT                [GRID_SIZE][GRID_SIZE]int // IntraWT
+	intraDVG               [GRID_SIZE][GRID_SIZE]int // IntraDVG
+	allowJumpRandomly      [][]bool
+	totalRandomJumpVirions int                              // record total number of randomly jumping Virions
+	totalRandomJumpDIPs    int                              // record total number of randomly jumping DIPs
+	lysisThreshold         [GRID_SIZE][GRID_SIZE]int        // fixed lysis time for each cell
+	regrowthThreshold      [GRID_SIZE][GRID_SIZE]int        // regrowth time of a dead cell (non-legacy regrowth distributions)
+	dipFateThreshold       [GRID_SIZE][GRID_SIZE]int        // time at which a DIP-only cell dies or recovers
+	dipOnlyDeaths          int                              // DIP-only cells that died
+	dipOnlyRecoveries      int                              // DIP-only cells that recovered
+	coinfectionExcluded    [GRID_SIZE][GRID_SIZE]bool       // cell has had a co-infection blocked
+	excludedCells          int                              // cells that had a co-infection blocked
+	ifnSpeciesConc         [][GRID_SIZE][GRID_SIZE]float64  // IFN concentration of each species
+	ifnSpeciesArea         [][GRID_SIZE][GRID_SIZE][][2]int // Neighbors within each species' radius
+	exogenousIFN           [GRID_SIZE][GRID_SIZE]float64    // Exogenously added IFN in each cell
+	cellType               [GRID_SIZE][GRID_SIZE]int        // index into cellProfiles
+	strainVirions          [][GRID_SIZE][GRID_SIZE]int      // virions of each strain; they sum to localVirions
+	strainMask             [GRID_SIZE][GRID_SIZE]uint32     // strains infecting each cell, one bit per strain
+	dipVariantDips         [][GRID_SIZE][GRID_SIZE]int      // DIPs of each variant; they sum to localDips
+	dipVariantMask         [GRID_SIZE][GRID_SIZE]uint64     // DIP variants infecting each cell, one bit per variant
+	frameNum               int                              // current time step, set by update
+	virionLedger           particleLedger                   // Mass balance of virions
+	dipLedger              particleLedger                   // Mass balance of DIPs
+
+}
+
+// Initialize the infection state
+func (g *Grid) initializeInfection(option int) {
+	// Use current time as seed for reproducibility
+	rand.Seed(time.Now().UnixNano())
+
+	vInit := int(math.Round(*flag_v_pfu_initial))
+	dInit := int(math.Round(*flag_d_pfu_initial))
+	if len(initialConditions) > 0 || initialState != "" {
+		option = 0 // a loaded state or the -initialCondition spec replaces the seeding options
+	}
+	if (option == 1 || option == 2) && noCell[25][25] {
+		log.Fatalf("Option %d seeds the centre cell, which is outside the well mask; use -option=3", option)
+	}
+
+	switch option {
+	case 0:
+		g.loadInitialState(initialState)
+		g.applyInitialConditions()
+	case 1:
+		if vInit > 0 {
+			g.localVirions[25][25] = vInit
+		} else {
+			fmt.Printf("v_pfu_initial < 0: %.2f\n", *flag_v_pfu_initial)
+		}
+		if dInit > 0 {
+			g.localDips[25][25] = dInit
+		} else {
+			fmt.Printf("d_pfu_initial < 0: %.2f\n", *flag_d_pfu_initial)
+		}
+	case 2:
+		if vInit > 0 && dInit > 0 {
+			g.state[25][25] = INFECTED_BOTH
+		} else if vInit > 0 {
+			g.state[25][25] = INFECTED_VIRION
+		} else if dInit > 0 {
+			g.state[25][25] = INFECTED_DIP
+		}
+		g.localVirions[25][25] = vInit
+		g.localDips[25][25] = dInit
+
+	case 3:
+		for k := 0; k < vInit; k++ {
+			i, j := randomCell()
+			g.localVirions[i][j]++
+		}
+		for k := 0; k < dInit; k++ {
+			i, j := randomCell()
+			g.localDips[i][j]++
+		}
+	}
+
+	g.seedStrainInoculum()
+	g.seedDIPVariantInoculum()
+
+	// The inoculum opens the particle ledgers
+	g.virionLedger.produced += g.totalVirions()
+	g.virionLedger.deposited += g.totalVirions()
+	g.dipLedger.produced += g.totalDIPs()
+	g.dipLedger.deposited += g.totalDIPs()
+}
+
+// Function to generate ticks dynamically
+func generateTicks(xMax float64, interval float64) []chart.Tick {
+	var ticks []chart.Tick
+	for value := 0.0; value <= xMax; value += interval {
+		label := fmt.Sprintf("%.0f", value) // Format the label as an integer
+		ticks = append(ticks, chart.Tick{
+			Value: value,
+			Label: label,
+		})
+	}
+	return ticks
+}
+
+// Initialize the grid, setting all cells to SUSCEPTIBLE
+func (g *Grid) initialize() {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.state[i][j] = SUSCEPTIBLE
+			g.stateChanged[i][j] = false // Initialize as unchanged
+			g.timeSinceInfectVorBoth[i][j] = -1
+			g.timeSinceDead[i][j] = -1
+			g.timeSinceRegrowth[i][j] = -1
+			g.IFNConcentration[i][j] = 0
+			g.antiviralDuration[i][j] = -1
+			g.timeSinceSusceptible[i][j] = 0
+			g.previousStates[i][j] = -1
+			g.antiviralFlag[i][j] = false
+			g.timeSinceAntiviral[i][j] = -1
+			g.intraWT[i][j] = 0
+			g.intraDVG[i][j] = 0
+			g.lysisThreshold[i][j] = -1
+			g.regrowthThreshold[i][j] = -1
+			g.dipFateThreshold[i][j] = -1
+			if noCell[i][j] {
+				g.state[i][j] = MASKED
+			}
+
+		}
+	}
+	g.ifnSpeciesConc = make([][GRID_SIZE][GRID_SIZE]float64, len(ifnSpeciesList))
+	g.strainVirions = make([][GRID_SIZE][GRID_SIZE]int, len(strains))
+	g.dipVariantDips = make([][GRID_SIZE][GRID_SIZE]int, len(dipVariants))
+
+	fmt.Println("Grid initialized")
+
+}
+
+// Ensure the entire canvas is initialized with uniform background color
+func fillBackground(img *image.RGBA, bgColor color.Color) {
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.Set(x, y, bgColor)
+		}
+	}
+}
+
+func (g *Grid) calculateDiffusionRates() (float64, float64) {
+	totalVirions := 0
+	totalVirionDiffusion := 0
+	totalDIPs := 0
+	totalDIPDiffusion := 0
+
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			virionMoves := g.localVirions[i][j]
+			dipMoves := g.localDips[i][j]
+
+			// Sum particles moved out for diffusion
+			totalVirionDiffusion += virionMoves
+			totalDIPDiffusion += dipMoves
+
+			// Add to total particles in the grid
+			totalVirions += g.localVirions[i][j]
+			totalDIPs += g.localDips[i][j]
+		}
+	}
+
+	virionDiffusionRate := float64(totalVirionDiffusion) / float64(totalVirions)
+	dipDiffusionRate := float64(totalDIPDiffusion) / float64(totalDIPs)
+	return virionDiffusionRate, dipDiffusionRate
+}
+
+// Function to get the nth figure number in the folder
+func getNextFigureNumber(outputFolder string) int {
+	files, err := os.ReadDir(outputFolder)
+	if err != nil {
+		log.Fatalf("Failed to read output folder: %v", err)
+	}
+	count := 0
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".png") {
+			count++
+		}
+	}
+	return count + 1 // Return the next number
+}
+
+// Logic to determine IFN spreading type
+func getIFNType() string {
+	if IFN_wave_radius == 0 && globalIFN > 0 {
+		return "Global"
+	} else if IFN_wave_radius == 10 {
+		return "IFNJ10"
+	} else {
+		return "NoIFN"
+	}
+}
+
+func generateFolderName(
+	no int,
+	jumpRandomly bool,
+	jumpRadiusD int,
+	jumpRadiusV int,
+	burstSizeD int,
+	burstSizeV int,
+	ifnWaveRadius int,
+	TAU int,
+	timeSteps int,
+) string {
+	// Determine Dinit naming part (keep at most 2 decimal places)
+	dInit := fmt.Sprintf("Dinit%s", strconv.FormatFloat(*flag_d_pfu_initial, 'f', -1, 64))
+
+	// Determine D naming part
+	dName := ""
+	if jumpRandomly {
+		dName = fmt.Sprintf("DIPBst%d_JRand", burstSizeD)
+	} else if jumpRadiusD > 0 {
+		dName = fmt.Sprintf("DIPBst%d_J%d", burstSizeD, jumpRadiusD)
+	} else if jumpRadiusD == 0 {
+		dName = fmt.Sprintf("DIPBst%d_noJ", burstSizeD)
+	} else {
+		if burstSizeD == 0 && *flag_d_pfu_initial == 0 && D_only_IFN_stimulate_ratio == 0 && jumpRadiusD == 0 {
+			dName = "NoDIP"
+		} else {
+			dName = fmt.Sprintf("DIPBst%d", burstSizeD)
+		}
+	}
+
+	// Determine Vinit naming part (keep at most 2 decimal places)
+	vInit := ""
+	if *flag_v_pfu_initial > 0 {
+		vInit = fmt.Sprintf("Vinit%s", strconv.FormatFloat(*flag_v_pfu_initial, 'f', -1, 64))
+	} else if jumpRandomly {
+		vInit = "JRand"
+	} else if jumpRadiusV > 0 {
+		vInit = fmt.Sprintf("J%d", jumpRadiusV)
+	} else {
+		vInit = "noJ"
+	}
+
+	vName := fmt.Sprintf("VBst%d", burstSizeV)
+
+	// Determine IFN naming part
+	ifnName := ""
+	if TAU == 0 {
+		ifnName = "NoIFN"
+	} else if ifnWaveRadius == 0 {
+		ifnName = "Global"
+	} else {
+		ifnName = fmt.Sprintf("IFN%d", ifnWaveRadius)
+	}
+
+	cellType := ""
+	if len(cellProfiles) > 1 {
+		var names []string
+		for _, c := range cellProfiles {
+			names = append(names, c.name)
+		}
+		cellType = strings.Join(names, "-")
+	} else if TAU > 0 {
+		cellType = "mdbk"
+	} else {
+		cellType = "vero"
+	}
+
+	folderName := fmt.Sprintf("%d_%s_%s_%s_%s_%s_%s_times%d_tau%d_ifnBothFold%.2f_grid%d_VStimulateIFN%t",
+		no, dInit, dName, vInit, vName, ifnName, cellType, timeSteps, TAU, ifnBothFold, GRID_SIZE, VStimulateIFN)
+
+	return folderName
+}
+
+// Combine images into one row
+func combineImagesHorizontally(images []*image.RGBA) *image.RGBA {
+	if len(images) == 0 {
+		return nil
+	}
+
+	// Calculate the width and height of the combined image
+	totalWidth := 0
+	maxHeight := 0
+	for _, img := range images {
+		totalWidth += img.Bounds().Dx() // accumulate width
+		if img.Bounds().Dy() > maxHeight {
+			maxHeight = img.Bounds().Dy() // calculate maximum height
+		}
+	}
+
+	// Create the combined image
+	combinedImg := image.NewRGBA(image.Rect(0, 0, totalWidth, maxHeight))
+	offsetX := 0
+	for _, img := range images {
+		rect := img.Bounds()
+		draw.Draw(combinedImg, image.Rect(offsetX, 0, offsetX+rect.Dx(), rect.Dy()), img, rect.Min, draw.Src)
+		offsetX += rect.Dx()
+	}
+
+	return combinedImg
+}
+
+// Save PNG image
+func savePNGImage(img *image.RGBA, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("Failed to create file %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	err = png.Encode(file, img)
+	if err != nil {
+		log.Fatalf("Failed to encode PNG: %v", err)
+	}
+}
+func contains(arr []int, val int) bool {
+	for _, v := range arr {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to calculate the maximum value from multiple datasets
+func calculateMax(data ...[]float64) float64 {
+	max := 0.0
+	for _, dataset := range data {
+		for _, value := range dataset {
+			if value > max {
+				max = value
+			}
+		}
+	}
+	return max
+}
+func LogValueFormatter(v interface{}) string {
+	if value, ok := v.(float64); ok && value > 0 {
+		return fmt.Sprintf("%.2f", math.Log10(value))
+	}
+	return "0"
+}
+func clampValues(data []float64, min, max float64) []float64 {
+	clamped := make([]float64, len(data))
+	for i, v := range data {
+		if v < min {
+			clamped[i] = min
+		} else if v > max {
+			clamped[i] = max
+		} else {
+			clamped[i] = v
+		}
+	}
+	return clamped
+}
+
+// Modified function definition
+func createInfectionGraph(frameNum int, virionOnly, dipOnly, both []float64, showLegend bool) *image.RGBA {
+	graphWidth := GRID_SIZE * CELL_SIZE * 2
+	graphHeight := 200
+
+	if frameNum < 1 {
+		log.Fatalf("Not enough data to render the graph: frameNum = %d", frameNum)
+	}
+
+	virionOnly = clampValues(virionOnly, 0.00, yMax)
+	dipOnly = clampValues(dipOnly, 0.00, yMax)
+	both = clampValues(both, 0.00, yMax)
+
+	// Dynamically set legend name
+	var series []chart.Series
+
+	series = []chart.Series{
+		chart.ContinuousSeries{
+			Name:    "Infected by Virion Only",
+			XValues: createTimeSeries(frameNum),
+			YValues: virionOnly,
+			Style:   chart.Style{StrokeColor: chart.ColorRed, StrokeWidth: 6.0},
+		},
+		chart.ContinuousSeries{
+			Name:    "Infected by DIP Only",
+			XValues: createTimeSeries(frameNum),
+			YValues: dipOnly,
+			Style:   chart.Style{StrokeColor: chart.ColorGreen, StrokeWidth: 6.0},
+		},
+		chart.ContinuousSeries{
+			Name:    "Infected by Both",
+			XValues: createTimeSeries(frameNum),
+			YValues: both,
+			Style:   chart.Style{StrokeColor: drawing.Color{R: 255, G: 165, B: 0, A: 255}, StrokeWidth: 8.0},
+		},
+	}
+	// Interventions are marked by dashed vertical lines
+	top := calculateMax(virionOnly, dipOnly, both)
+	if top == 0 {
+		top = yMax
+	}
+	for _, t := range interventionMarks(frameNum) {
+		series = append(series, chart.ContinuousSeries{
+			XValues: []float64{t, t},
+			YValues: []float64{0, top},
+			Style:   chart.Style{StrokeColor: chart.ColorBlack, StrokeWidth: 2.0, StrokeDashArray: []float64{4, 4}},
+		})
+	}
+
+	graph := chart.Chart{
+		Width:  GRID_SIZE * CELL_SIZE * 1.51,
+		Height: 100,
+		XAxis: chart.XAxis{
+			Style: chart.Style{FontSize: 10.0},
+			ValueFormatter: func(v interface{}) string {
+				return fmt.Sprintf("%d", int(v.(float64)))
+			},
+			Ticks: generateTicks(xMax, ticksInterval),
+		},
+		YAxis: chart.YAxis{
+			Style: chart.Style{FontSize: 10.0},
+		},
+		Series: series,
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := graph.Render(chart.PNG, buffer)
+	if err != nil {
+		log.Fatalf("Failed to render graph: %v", err)
+	}
+
+	graphImg, _, err := image.Decode(buffer)
+	if err != nil {
+		log.Fatalf("Failed to decode graph image: %v", err)
+	}
+
+	rgbaImg := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
+	draw.Draw(rgbaImg, rgbaImg.Bounds(), graphImg, image.Point{}, draw.Src)
+
+	return rgbaImg
+}
+
+// saveCurrentGoFile saves the current Go source file into the specified output folder.
+// saveCurrentGoFile saves the current Go source file with its original name and a timestamp.
+func saveCurrentGoFile(outputFolder string) {
+	_, currentFile, _, ok := runtime.Caller(0)
+	if !ok {
+		log.Println("Unable to get current Go file path")
+		return
+	}
+
+	// Get the base name of the current Go file (without path)
+	originalFileName := filepath.Base(currentFile)
+
+	// Generate timestamp
+	timestamp := time.Now().Format("20060102_150405") // Format: YYYYMMDD_HHMMSS
+
+	// Target filename: original filename_timestamp.go
+	newFileName := fmt.Sprintf("%s_%s.go", originalFileName[:len(originalFileName)-3], timestamp)
+	outputFilePath := filepath.Join(outputFolder, newFileName)
+	// Read Go file content
+	content, err := ioutil.ReadFile(currentFile)
+	if err != nil {
+		log.Printf("cant read file %s: %v\n", currentFile, err)
+		return
+	}
+
+	// Ensure target folder exists
+	if err := os.MkdirAll(outputFolder, os.ModePerm); err != nil {
+		log.Printf("cant make outputfolder %s: %v\n", outputFolder, err)
+		return
+	}
+
+	// Write file
+	err = ioutil.WriteFile(outputFilePath, content, 0644)
+	if err != nil {
+		log.Printf("cant save file to %s: %v\n", outputFilePath, err)
+		return
+	}
+
+	log.Printf("file successfully saved in %s\n", outputFilePath)
+}
+
+func getNextFolderNumber(basePath string) int {
+	files, err := os.ReadDir(basePath)
+	if err != nil {
+		log.Fatalf("Failed to read directory %s: %v", basePath, err)
+	}
+
+	maxNumber := 0
+	for _, file := range files {
+		if file.IsDir() {
+			// Try to parse number from folder name
+			var folderNumber int
+			_, err := fmt.Sscanf(file.Name(), "%d", &folderNumber)
+			if err == nil && folderNumber > maxNumber {
+				maxNumber = folderNumber
+			}
+		}
+	}
+	return maxNumber + 1 // Return next available number
+}
+
+func transformToLogScale(data []float64) []float64 {
+	transformed := make([]float64, len(data))
+	for i, value := range data {
+		if value > 0 {
+			transformed[i] = math.Log10(value)
+		} else {
+			transformed[i] = math.Log10(0.0001) // handle log(0) case, use a very small value instead
+		}
+	}
+	return transformed
+}
+
+func createTimeSeries(frameNum int) []float64 {
+	if frameNum < 1 {
+		return []float64{0, 1} // Return a default time series if not enough data
+	}
+
+	timeSeries := make([]float64, frameNum+1)
+	for i := 0; i <= frameNum; i++ {
+		timeSeries[i] = float64(i)
+	}
+	return timeSeries
+}
+
+// Function to calculate total virions in the grid
+func (g *Grid) totalVirions() int {
+	totalVirions := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			totalVirions += g.localVirions[i][j]
+		}
+	}
+	return totalVirions
+}
+
+// Function to calculate total DIPs in the grid
+func (g *Grid) totalDIPs() int {
+	totalDIPs := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			totalDIPs += g.localDips[i][j]
+		}
+	}
+	return totalDIPs
+}
+
+// Function to calculate the total number of regrowth cells in the grid
+func (g *Grid) calculateRegrowthCount() int {
+	regrowthCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == REGROWTH {
+				regrowthCells++
+				g.timeSinceRegrowth[i][j] += TIMESTEP
+			}
+		}
+	}
+	return regrowthCells
+}
+
+// Function to calculate the percentage of susceptible cells in the grid
+func (g *Grid) calculateSusceptiblePercentage() float64 {
+	totalCells := len(realCells)
+	susceptibleCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == SUSCEPTIBLE {
+				susceptibleCells++
+				g.timeSinceSusceptible[i][j] += TIMESTEP
+			}
+		}
+	}
+	return (float64(susceptibleCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of regrowthed or antiviral cells
+func (g *Grid) calculateRegrowthedOrAntiviralPercentage() float64 {
+	totalCells := len(realCells)
+	regrowthedOrAntiviralCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == REGROWTH || g.state[i][j] == ANTIVIRAL {
+				regrowthedOrAntiviralCells++
+			}
+		}
+	}
+	return (float64(regrowthedOrAntiviralCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of infected cells (both virion and DIP infections)
+func (g *Grid) calculateInfectedPercentage() float64 {
+	totalCells := len(realCells)
+	infectedCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_BOTH {
+				infectedCells++
+			}
+		}
+	}
+	return (float64(infectedCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of DIP-only infected cells
+func (g *Grid) calculateInfectedDIPOnlyPercentage() float64 {
+	totalCells := len(realCells)
+	infectedDIPOnlyCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == INFECTED_DIP {
+				infectedDIPOnlyCells++
+			}
+		}
+	}
+	return (float64(infectedDIPOnlyCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of cells infected by both virions and DIPs
+func (g *Grid) calculateInfectedBothPercentage() float64 {
+	totalCells := len(realCells)
+	infectedBothCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == INFECTED_BOTH {
+				infectedBothCells++
+			}
+		}
+	}
+	return (float64(infectedBothCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of antiviral cells (if antiviral state is modeled)
+func (g *Grid) calculateAntiviralPercentage() float64 {
+	totalCells := len(realCells)
+	antiviralCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == ANTIVIRAL {
+				antiviralCells++
+			}
+		}
+	}
+	return (float64(antiviralCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of uninfected cells (susceptible and regrowth cells)
+func (g *Grid) calculateUninfectedPercentage() float64 {
+	totalCells := len(realCells)
+	uninfectedCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH {
+				uninfectedCells++
+			}
+		}
+	}
+	return (float64(uninfectedCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate plaque percentage (for simplicity, counting dead cells as plaques)
+func (g *Grid) calculatePlaquePercentage() float64 {
+	totalCells := len(realCells)
+	plaqueCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == DEAD {
+				plaqueCells++
+			}
+		}
+	}
+	return (float64(plaqueCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the percentage of dead cells
+func calculateDeadCellPercentage(grid [GRID_SIZE][GRID_SIZE]int) float64 {
+	totalCells := len(realCells)
+	deadCells := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if grid[i][j] == DEAD {
+				deadCells++
+			}
+		}
+	}
+	return (float64(deadCells) / float64(totalCells)) * 100
+}
+
+// Function to calculate the number of cells infected by virion only
+func (g *Grid) calculateVirionOnlyInfected() int {
+	virionOnlyInfected := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == INFECTED_VIRION {
+				virionOnlyInfected++
+			}
+		}
+	}
+	return virionOnlyInfected
+}
+
+// Function to calculate the number of cells infected by DIP only
+func (g *Grid) calculateDipOnlyInfected() int {
+	dipOnlyInfected := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == INFECTED_DIP {
+				dipOnlyInfected++
+			}
+		}
+	}
+	return dipOnlyInfected
+}
+
+// Function to calculate the number of cells infected by both virion and DIP
+func (g *Grid) calculateBothInfected() int {
+	bothInfected := 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if g.state[i][j] == INFECTED_BOTH {
+				bothInfected++
+			}
+		}
+	}
+	return bothInfected
+}
+
+// plaques returns the connected groups of at least minPlaqueSize dead cells, each as
+// its list of cells
+func (g *Grid) plaques() [][][2]int {
+	var found [][][2]int
+	var seen [GRID_SIZE][GRID_SIZE]bool
+	for _, c := range realCells {
+		if seen[c[0]][c[1]] || g.state[c[0]][c[1]] != DEAD {
+			continue
+		}
+		seen[c[0]][c[1]] = true
+		plaque := [][2]int{c}
+		for n := 0; n < len(plaque); n++ {
+			for _, nb := range g.neighbors1[plaque[n][0]][plaque[n][1]] {
+				if nb == [2]int{-1, -1} || seen[nb[0]][nb[1]] || g.state[nb[0]][nb[1]] != DEAD {
+					continue
+				}
+				seen[nb[0]][nb[1]] = true
+				plaque = append(plaque, nb)
+			}
+		}
+		if len(plaque) >= minPlaqueSize {
+			found = append(found, plaque)
+		}
+	}
+	return found
+}
+
+// writePlaques counts the plaques on the grid into plaques.csv, one row per plaque
+// with its size and centre
+func (g *Grid) writePlaques(outputFolder string, frameNum int) {
+	file, err := os.Create(filepath.Join(outputFolder, "plaques.csv"))
+	if err != nil {
+		log.Fatalf("Failed to create plaque CSV file: %v", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"Time", "plaque", "size", "centreI", "centreJ"})
+	found := g.plaques()
+	for n, plaque := range found {
+		ci, cj := 0, 0
+		for _, c := range plaque {
+			ci += c[0]
+			cj += c[1]
+		}
+		writer.Write([]string{strconv.Itoa(frameNum), strconv.Itoa(n + 1), strconv.Itoa(len(plaque)),
+			strconv.Itoa(ci / len(plaque)), strconv.Itoa(cj / len(plaque))})
+	}
+	fmt.Printf("Time step %d: %d plaques of at least %d cells\n", frameNum, len(found), minPlaqueSize)
+}
+
+// Hexagonal lattice
+//
+// Cells (i, j) are drawn as flat-topped hexagons in column i and row j, with odd
+// columns shifted down by half a cell ("odd-q" offset layout). Distances, rings and
+// discs are computed in axial coordinates (q, r); the third cube coordinate is
+// s = -q - r. The simulation neighbourhoods and the renderer both use these helpers.
+
+// Axial hex coordinate
+type hexAxial struct {
+	q, r int
+}
+
+// The six axial directions, counter-clockwise starting at the lower-right neighbour
+var hexDirections = [6]hexAxial{{1, 0}, {1, -1}, {0, -1}, {-1, 0}, {-1, 1}, {0, 1}}
+
+func (h hexAxial) add(o hexAxial) hexAxial {
+	return hexAxial{h.q + o.q, h.r + o.r}
+}
+
+func (h hexAxial) scale(k int) hexAxial {
+	return hexAxial{h.q * k, h.r * k}
+}
+
+// Convert grid indices (column i, row j) to axial coordinates
+func offsetToAxial(i, j int) hexAxial {
+	return hexAxial{q: i, r: j - (i-(i&1))/2}
+}
+
+// Convert axial coordinates back to grid indices (column i, row j)
+func axialToOffset(h hexAxial) (int, int) {
+	return h.q, h.r + (h.q-(h.q&1))/2
+}
+
+// Number of hex steps between two cells
+func hexDistance(a, b hexAxial) int {
+	dq := a.q - b.q
+	dr := a.r - b.r
+	return (abs(dq) + abs(dr) + abs(dq+dr)) / 2
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// All cells at exactly the given hex distance from center (6*radius cells)
+func hexRing(center hexAxial, radius int) []hexAxial {
+	if radius == 0 {
+		return []hexAxial{center}
+	}
+	ring := make([]hexAxial, 0, 6*radius)
+	h := center.add(hexDirections[4].scale(radius))
+	for side := 0; side < 6; side++ {
+		for step := 0; step < radius; step++ {
+			ring = append(ring, h)
+			h = h.add(hexDirections[side])
+		}
+	}
+	return ring
+}
+
+// All cells within the given hex distance from center (1 + 3*radius*(radius+1) cells)
+func hexDisc(center hexAxial, radius int) []hexAxial {
+	var disc []hexAxial
+	for k := 0; k <= radius; k++ {
+		disc = append(disc, hexRing(center, k)...)
+	}
+	return disc
+}
+
+// Pixel center of cell (i, j) for hexagons of circumradius CELL_SIZE
+func hexToPixel(i, j int) (float64, float64) {
+	h := offsetToAxial(i, j)
+	x := float64(CELL_SIZE) * 3 / 2 * float64(h.q)
+	y := float64(CELL_SIZE) * math.Sqrt(3) * (float64(h.r) + float64(h.q)/2)
+	return x, y
+}
+
+// Cell containing pixel (x, y), the inverse of hexToPixel
+func pixelToHex(x, y float64) (int, int) {
+	q := x * 2 / 3 / float64(CELL_SIZE)
+	r := (-x/3 + math.Sqrt(3)/3*y) / float64(CELL_SIZE)
+	// Round in cube coordinates so that q + r + s stays 0
+	s := -q - r
+	rq, rr, rs := math.Round(q), math.Round(r), math.Round(s)
+	dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs-s)
+	if dq > dr && dq > ds {
+		rq = -rr - rs
+	} else if dr > ds {
+		rr = -rq - rs
+	}
+	return axialToOffset(hexAxial{int(rq), int(rr)})
+}
+
+// resolveCell maps a target cell onto the grid according to the boundary condition.
+// ok is false when the target is off the grid and the boundary is absorbing, or when
+// it lands outside the well mask (the well wall always absorbs).
+func resolveCell(i, j int) (int, int, bool) {
+	switch boundaryCondition {
+	case "periodic":
+		// GRID_SIZE is even, so wrapping columns keeps the odd-q layout consistent
+		i, j = (i%GRID_SIZE+GRID_SIZE)%GRID_SIZE, (j%GRID_SIZE+GRID_SIZE)%GRID_SIZE
+	case "reflecting":
+		i, j = reflectIndex(i), reflectIndex(j)
+	}
+	if i < 0 || i >= GRID_SIZE || j < 0 || j >= GRID_SIZE {
+		return i, j, false
+	}
+	return i, j, !noCell[i][j]
+}
+
+// Mirror an index back across the grid edge, e.g. -1 -> 0 and GRID_SIZE -> GRID_SIZE-1
+func reflectIndex(x int) int {
+	period := 2 * GRID_SIZE
+	x = (x%period + period) % period
+	if x >= GRID_SIZE {
+		x = period - 1 - x
+	}
+	return x
+}
+
+// Well geometry: noCell marks lattice sites without a cell and realCells lists the others.
+// Masked sites never change state and are left out of every cell percentage.
+var (
+	noCell    [GRID_SIZE][GRID_SIZE]bool
+	realCells [][2]int
+)
+
+// loadWellMask builds noCell from the -wellMask spec
+func loadWellMask(spec string) {
+	if spec != "" {
+		kind, args, _ := strings.Cut(spec, ":")
+		switch kind {
+		case "circle", "annulus":
+			var radii []float64
+			if args != "" {
+				for _, r := range strings.Split(args, ":") {
+					v, err := strconv.ParseFloat(r, 64)
+					if err != nil || v < 0 {
+						log.Fatalf("Invalid well mask radius %q in %q", r, spec)
+					}
+					radii = append(radii, v)
+				}
+			}
+			inner, outer := 0.0, float64(GRID_SIZE)/2
+			switch {
+			case kind == "circle" && len(radii) == 1:
+				outer = radii[0]
+			case kind == "annulus" && len(radii) == 2:
+				inner, outer = radii[0], radii[1]
+			case kind == "annulus" || len(radii) > 1:
+				log.Fatalf("Invalid well mask %q: want circle[:radius] or annulus:inner:outer", spec)
+			}
+			// Euclidean distance between hexagon centres, in cell spacings
+			spacing := float64(CELL_SIZE) * math.Sqrt(3)
+			cx, cy := hexToPixel(GRID_SIZE/2, GRID_SIZE/2)
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					x, y := hexToPixel(i, j)
+					d := math.Hypot(x-cx, y-cy) / spacing
+					noCell[i][j] = d > outer || d < inner
+				}
+			}
+		default:
+			file, err := os.Open(spec)
+			if err != nil {
+				log.Fatalf("Failed to open well mask: %v", err)
+			}
+			img, _, err := image.Decode(file)
+			file.Close()
+			if err != nil {
+				log.Fatalf("Failed to decode well mask %s: %v", spec, err)
+			}
+			// Stretch the image over the grid (column i <- x, row j <- y); dark pixels have no cell
+			b := img.Bounds()
+			for i := 0; i < GRID_SIZE; i++ {
+				for j := 0; j < GRID_SIZE; j++ {
+					px := b.Min.X + (2*i+1)*b.Dx()/(2*GRID_SIZE)
+					py := b.Min.Y + (2*j+1)*b.Dy()/(2*GRID_SIZE)
+					noCell[i][j] = color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y < 128
+				}
+			}
+		}
+	}
+
+	realCells = realCells[:0]
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			if !noCell[i][j] {
+				realCells = append(realCells, [2]int{i, j})
+			}
+		}
+	}
+	if len(realCells) == 0 {
+		log.Fatalf("Well mask %q leaves no cells", spec)
 	}
+}
 
-	fmt.Println("Grid initialized")
+// Uniformly random cell inside the well
+func randomCell() (int, int) {
+	c := realCells[rand.Intn(len(realCells))]
+	return c[0], c[1]
+}
 
+// Dispersal kernel for one particle type. gaussian, exponential and powerlaw draw a
+// continuous displacement (in cell spacings) that is snapped to the hex under it.
+type dispersalKernel struct {
+	kind    string // nearest, gaussian, exponential, powerlaw or disc
+	param   float64
+	offsets []hexAxial // disc cells around the origin
 }
 
-// Ensure the entire canvas is initialized with uniform background color
-func fillBackground(img *image.RGBA, bgColor color.Color) {
-	for y := 0; y < img.Bounds().Dy(); y++ {
-		for x := 0; x < img.Bounds().Dx(); x++ {
-			img.Set(x, y, bgColor)
+// parseKernel parses a kernel spec such as "gaussian:2.5"
+func parseKernel(spec string) *dispersalKernel {
+	kind, value, hasValue := strings.Cut(spec, ":")
+	k := &dispersalKernel{kind: kind}
+	if kind == "nearest" {
+		if hasValue {
+			log.Fatalf("Kernel %q takes no parameter", spec)
 		}
+		return k
 	}
+	if kind != "gaussian" && kind != "exponential" && kind != "powerlaw" && kind != "disc" {
+		log.Fatalf("Unknown dispersal kernel %q: want nearest, gaussian:σ, exponential:λ, powerlaw:α or disc:r", spec)
+	}
+	p, err := strconv.ParseFloat(value, 64)
+	if !hasValue || err != nil || p <= 0 {
+		log.Fatalf("Kernel %q needs a positive parameter", spec)
+	}
+	if kind == "powerlaw" && p <= 1 {
+		log.Fatalf("Power-law exponent must be > 1, got %v", p)
+	}
+	k.param = p
+	if kind == "disc" {
+		k.offsets = hexDisc(hexAxial{}, int(p))
+	}
+	return k
 }
 
-func (g *Grid) calculateDiffusionRates() (float64, float64) {
-	totalVirions := 0
-	totalVirionDiffusion := 0
-	totalDIPs := 0
-	totalDIPDiffusion := 0
+// sample draws the landing cell of one particle released at (i, j); ok is false if it is lost
+func (k *dispersalKernel) sample(i, j int) (int, int, bool) {
+	var r float64
+	switch k.kind {
+	case "nearest":
+		return resolveCell(axialToOffset(offsetToAxial(i, j).add(hexDirections[rand.Intn(6)])))
+	case "disc":
+		return resolveCell(axialToOffset(offsetToAxial(i, j).add(k.offsets[rand.Intn(len(k.offsets))])))
+	case "gaussian":
+		dx, dy := rand.NormFloat64()*k.param, rand.NormFloat64()*k.param
+		return k.snap(i, j, dx, dy)
+	case "exponential":
+		r = rand.ExpFloat64() * k.param
+	case "powerlaw":
+		// Pareto distance with minimum one cell spacing: P(r > x) = x^(1-α)
+		r = math.Pow(1-rand.Float64(), -1/(k.param-1))
+	}
+	theta := 2 * math.Pi * rand.Float64()
+	return k.snap(i, j, r*math.Cos(theta), r*math.Sin(theta))
+}
 
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			virionMoves := g.localVirions[i][j]
-			dipMoves := g.localDips[i][j]
+// snap moves (i, j) by (dx, dy) cell spacings and returns the hex that contains the point
+func (k *dispersalKernel) snap(i, j int, dx, dy float64) (int, int, bool) {
+	spacing := float64(CELL_SIZE) * math.Sqrt(3)
+	x, y := hexToPixel(i, j)
+	return resolveCell(pixelToHex(x+dx*spacing, y+dy*spacing))
+}
 
-			// Sum particles moved out for diffusion
-			totalVirionDiffusion += virionMoves
-			totalDIPDiffusion += dipMoves
+// Spread settings of one particle type
+type spreadSettings struct {
+	mode   string           // celltocell, jumprandomly, jumpradius or partition
+	radius int              // jump radius, 0 unless mode is jumpradius
+	kJumpR float64          // fraction of the burst that jumps randomly in partition mode
+	kernel *dispersalKernel // overrides mode when set
+}
 
-			// Add to total particles in the grid
-			totalVirions += g.localVirions[i][j]
-			totalDIPs += g.localDips[i][j]
+var virionSpread, dipSpread spreadSettings
+
+// parseSpreadSettings builds the settings of one particle type from its flags
+func parseSpreadSettings(mode string, radius int, kJumpR float64, kernel string) spreadSettings {
+	s := spreadSettings{mode: mode, kJumpR: kJumpR}
+	switch mode {
+	case "celltocell", "jumprandomly":
+	case "jumpradius":
+		if radius < 0 {
+			log.Fatalf("Jump radius must be >= 0, got %d", radius)
 		}
+		s.radius = radius
+	case "partition":
+		if kJumpR < 0 || kJumpR > 1 {
+			log.Fatalf("kJumpR must be in [0, 1], got %v", kJumpR)
+		}
+	default:
+		log.Fatalf("Unknown particle spread option: %s", mode)
 	}
+	if kernel != "" {
+		s.kernel = parseKernel(kernel)
+	}
+	return s
+}
 
-	virionDiffusionRate := float64(totalVirionDiffusion) / float64(totalVirions)
-	dipDiffusionRate := float64(totalDIPDiffusion) / float64(totalDIPs)
-	return virionDiffusionRate, dipDiffusionRate
+// overlay returns the settings after an overlay event; the parameters the event leaves
+// out keep their current values, and a jump radius not in use falls back to flagRadius
+func (s spreadSettings) overlay(e *intervention, flagRadius int) spreadSettings {
+	mode, radius, kJumpR := s.mode, flagRadius, s.kJumpR
+	if s.mode == "jumpradius" {
+		radius = s.radius
+	}
+	if e.mode != "" {
+		mode = e.mode
+	}
+	if e.radius >= 0 {
+		radius = e.radius
+	}
+	if e.kJumpR >= 0 {
+		kJumpR = e.kJumpR
+	}
+	return parseSpreadSettings(mode, radius, kJumpR, e.kernel)
 }
 
-// Function to get the nth figure number in the folder
-func getNextFigureNumber(outputFolder string) int {
-	files, err := os.ReadDir(outputFolder)
-	if err != nil {
-		log.Fatalf("Failed to read output folder: %v", err)
+// describe summarises the settings for interventions.csv
+func (s spreadSettings) describe() string {
+	if s.kernel != nil && s.kernel.kind == "nearest" {
+		return "spread by kernel nearest"
 	}
-	count := 0
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".png") {
-			count++
-		}
+	if s.kernel != nil {
+		return "spread by kernel " + s.kernel.kind + ":" + strconv.FormatFloat(s.kernel.param, 'f', -1, 64)
 	}
-	return count + 1 // Return the next number
+	switch s.mode {
+	case "jumpradius":
+		return "spread by jumpradius " + strconv.Itoa(s.radius)
+	case "partition":
+		return "spread by partition " + strconv.FormatFloat(s.kJumpR, 'f', -1, 64)
+	}
+	return "spread by " + s.mode
 }
 
-// Logic to determine IFN spreading type
-func getIFNType() string {
-	if IFN_wave_radius == 0 && globalIFN > 0 {
-		return "Global"
-	} else if IFN_wave_radius == 10 {
-		return "IFNJ10"
-	} else {
-		return "NoIFN"
+// setJumpDiscs rebuilds one table of jump targets for a new jump radius
+func (g *Grid) setJumpDiscs(ring *[GRID_SIZE][GRID_SIZE][][2]int, radius int) {
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			ring[i][j] = jumpDisc(i, j, radius)
+		}
 	}
 }
 
-func generateFolderName(
-	no int,
-	jumpRandomly bool,
-	jumpRadiusD int,
-	jumpRadiusV int,
-	burstSizeD int,
-	burstSizeV int,
-	ifnWaveRadius int,
-	TAU int,
-	timeSteps int,
-) string {
-	// Determine Dinit naming part (keep at most 2 decimal places)
-	dInit := fmt.Sprintf("Dinit%s", strconv.FormatFloat(*flag_d_pfu_initial, 'f', -1, 64))
+// Mass balance of one particle type, cumulative since the start of the run. Every
+// particle produced is deposited or lost, and the particles on the grid are those
+// deposited minus those decayed or consumed.
+type particleLedger struct {
+	produced     int // inoculum and burst releases
+	deposited    int // landed on a grid cell
+	decayed      int // removed by the half-life
+	lostOffGrid  int // released across an absorbing boundary or outside the well
+	lostRounding int // integer-share remainders dropped by cell-to-cell spread; 0 now that they are sampled
+	lostBlocked  int // legacy distance-1 shares aimed at non-susceptible cells
+	consumed     int // taken up by cells on entry
+	washed       int // removed by media washes
+}
 
-	// Determine D naming part
-	dName := ""
-	if jumpRandomly {
-		dName = fmt.Sprintf("DIPBst%d_JRand", burstSizeD)
-	} else if jumpRadiusD > 0 {
-		dName = fmt.Sprintf("DIPBst%d_J%d", burstSizeD, jumpRadiusD)
-	} else if jumpRadiusD == 0 {
-		dName = fmt.Sprintf("DIPBst%d_noJ", burstSizeD)
-	} else {
-		if burstSizeD == 0 && *flag_d_pfu_initial == 0 && D_only_IFN_stimulate_ratio == 0 && jumpRadiusD == 0 {
-			dName = "NoDIP"
-		} else {
-			dName = fmt.Sprintf("DIPBst%d", burstSizeD)
+// checkLedger stops the run when a ledger does not balance against the grid
+func (g *Grid) checkLedger(frameNum int) {
+	for _, c := range []struct {
+		name   string
+		ledger particleLedger
+		onGrid int
+	}{
+		{"virion", g.virionLedger, g.totalVirions()},
+		{"DIP", g.dipLedger, g.totalDIPs()},
+	} {
+		l := c.ledger
+		if l.produced != l.deposited+l.lostOffGrid+l.lostRounding+l.lostBlocked {
+			log.Fatalf("Time step %d: %s ledger does not balance: produced %d != deposited %d + off-grid %d + rounding %d + blocked %d",
+				frameNum, c.name, l.produced, l.deposited, l.lostOffGrid, l.lostRounding, l.lostBlocked)
+		}
+		if c.onGrid != l.deposited-l.decayed-l.consumed-l.washed {
+			log.Fatalf("Time step %d: %d %ss on the grid, ledger expects deposited %d - decayed %d - consumed %d - washed %d",
+				frameNum, c.onGrid, c.name, l.deposited, l.decayed, l.consumed, l.washed)
 		}
 	}
-
-	// Determine Vinit naming part (keep at most 2 decimal places)
-	vInit := ""
-	if *flag_v_pfu_initial > 0 {
-		vInit = fmt.Sprintf("Vinit%s", strconv.FormatFloat(*flag_v_pfu_initial, 'f', -1, 64))
-	} else if jumpRandomly {
-		vInit = "JRand"
-	} else if jumpRadiusV > 0 {
-		vInit = fmt.Sprintf("J%d", jumpRadiusV)
-	} else {
-		vInit = "noJ"
+	if len(strains) > 0 {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				sum := 0
+				for k := range strains {
+					sum += g.strainVirions[k][i][j]
+				}
+				if sum != g.localVirions[i][j] {
+					log.Fatalf("Time step %d: strain virions at (%d, %d) sum to %d, total is %d", frameNum, i, j, sum, g.localVirions[i][j])
+				}
+			}
+		}
+	}
+	if len(dipVariants) > 0 {
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				sum := 0
+				for k := range dipVariants {
+					sum += g.dipVariantDips[k][i][j]
+				}
+				if sum != g.localDips[i][j] {
+					log.Fatalf("Time step %d: DIP variants at (%d, %d) sum to %d, total is %d", frameNum, i, j, sum, g.localDips[i][j])
+				}
+			}
+		}
 	}
+}
 
-	vName := fmt.Sprintf("VBst%d", burstSizeV)
+// Intracellular model: infected cells carry WT and DVG genome copies (intraWT, intraDVG)
+// that replicate logistically up to genomeCapacity. DVGs replicate dipSynthesisAdvantage
+// times faster than WT but only while WT is present to supply the replicase.
+var (
+	intracellularModel    bool
+	wtReplicationRate     float64 // per hour
+	dipSynthesisAdvantage float64 // DVG replication rate relative to WT
+	genomeCapacity        float64 // genome copies a cell can hold
+)
 
-	// Determine IFN naming part
-	ifnName := ""
-	if TAU == 0 {
-		ifnName = "NoIFN"
-	} else if ifnWaveRadius == 0 {
-		ifnName = "Global"
-	} else {
-		ifnName = fmt.Sprintf("IFN%d", ifnWaveRadius)
+// seedGenomes adds the genomes of the particles that infected the cell at (i, j)
+func (g *Grid) seedGenomes(i, j int, byVirion, byDip bool) {
+	if !intracellularModel {
+		return
 	}
-
-	cellType := ""
-	if TAU > 0 {
-		cellType = "mdbk"
-	} else {
-		cellType = "vero"
+	if byVirion {
+		g.intraWT[i][j]++
+	}
+	if byDip {
+		g.intraDVG[i][j]++
 	}
-
-	folderName := fmt.Sprintf("%d_%s_%s_%s_%s_%s_%s_times%d_tau%d_ifnBothFold%.2f_grid%d_VStimulateIFN%t",
-		no, dInit, dName, vInit, vName, ifnName, cellType, timeSteps, TAU, ifnBothFold, GRID_SIZE, VStimulateIFN)
-
-	return folderName
 }
 
-// Combine images into one row
-func combineImagesHorizontally(images []*image.RGBA) *image.RGBA {
-	if len(images) == 0 {
-		return nil
+// replicateGenomes advances the genomes of every infected cell by one time step
+func (g *Grid) replicateGenomes() {
+	if !intracellularModel {
+		return
 	}
-
-	// Calculate the width and height of the combined image
-	totalWidth := 0
-	maxHeight := 0
-	for _, img := range images {
-		totalWidth += img.Bounds().Dx() // accumulate width
-		if img.Bounds().Dy() > maxHeight {
-			maxHeight = img.Bounds().Dy() // calculate maximum height
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			switch g.state[i][j] {
+			case INFECTED_VIRION, INFECTED_DIP, INFECTED_BOTH:
+			default:
+				continue
+			}
+			wt, dvg := float64(g.intraWT[i][j]), float64(g.intraDVG[i][j])
+			free := math.Max(0, 1-(wt+dvg)/genomeCapacity)
+			growth := wtReplicationRate * float64(TIMESTEP) * free
+			g.intraWT[i][j] = stochasticRound(wt + growth*wt)
+			if wt > 0 {
+				g.intraDVG[i][j] = stochasticRound(dvg + growth*dipSynthesisAdvantage*dvg)
+			}
 		}
 	}
+}
 
-	// Create the combined image
-	combinedImg := image.NewRGBA(image.Rect(0, 0, totalWidth, maxHeight))
-	offsetX := 0
-	for _, img := range images {
-		rect := img.Bounds()
-		draw.Draw(combinedImg, image.Rect(offsetX, 0, offsetX+rect.Dx(), rect.Dy()), img, rect.Min, draw.Src)
-		offsetX += rect.Dx()
+// stochasticRound rounds x down or up with probability given by its fractional part,
+// so that slow growth of few copies is not rounded away every step
+func stochasticRound(x float64) int {
+	n := math.Floor(x)
+	if rand.Float64() < x-n {
+		n++
 	}
+	return int(n)
+}
 
-	return combinedImg
+// genomeBursts returns the virions and DIPs released by a lysing cell: a cell filled
+// with WT releases BURST_SIZE_V virions, a cell filled with DVG BURST_SIZE_D DIPs
+func (g *Grid) genomeBursts(i, j int) (int, int) {
+	burstV := int(math.Round(float64(BURST_SIZE_V) * float64(g.intraWT[i][j]) / genomeCapacity))
+	burstD := int(math.Round(float64(BURST_SIZE_D) * float64(g.intraDVG[i][j]) / genomeCapacity))
+	return burstV, burstD
 }
 
-// Save PNG image
-func savePNGImage(img *image.RGBA, filename string) {
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Fatalf("Failed to create file %s: %v", filename, err)
+// genomeIFNStimulation scales the DIP part of a cell's IFN production by its genomes:
+// the DVG:WT ratio for co-infected cells and the DVG copies for DIP-only cells
+func (g *Grid) genomeIFNStimulation(i, j int, stimulation float64) float64 {
+	if !intracellularModel {
+		return stimulation
 	}
-	defer file.Close()
-
-	err = png.Encode(file, img)
-	if err != nil {
-		log.Fatalf("Failed to encode PNG: %v", err)
+	if g.state[i][j] == INFECTED_DIP {
+		return stimulation * float64(g.intraDVG[i][j])
 	}
-}
-func contains(arr []int, val int) bool {
-	for _, v := range arr {
-		if v == val {
-			return true
-		}
+	if g.intraWT[i][j] > 0 {
+		return stimulation * float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
 	}
-	return false
+	return stimulation
 }
 
-// Function to calculate the maximum value from multiple datasets
-func calculateMax(data ...[]float64) float64 {
-	max := 0.0
-	for _, dataset := range data {
-		for _, value := range dataset {
-			if value > max {
-				max = value
+// Mean WT and DVG genome copies over infected cells
+func (g *Grid) meanGenomes() (float64, float64) {
+	cells, wt, dvg := 0, 0, 0
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			switch g.state[i][j] {
+			case INFECTED_VIRION, INFECTED_DIP, INFECTED_BOTH:
+				cells++
+				wt += g.intraWT[i][j]
+				dvg += g.intraDVG[i][j]
 			}
 		}
 	}
-	return max
-}
-func LogValueFormatter(v interface{}) string {
-	if value, ok := v.(float64); ok && value > 0 {
-		return fmt.Sprintf("%.2f", math.Log10(value))
+	if cells == 0 {
+		return 0, 0
 	}
-	return "0"
+	return float64(wt) / float64(cells), float64(dvg) / float64(cells)
 }
-func clampValues(data []float64, min, max float64) []float64 {
-	clamped := make([]float64, len(data))
-	for i, v := range data {
-		if v < min {
-			clamped[i] = min
-		} else if v > max {
-			clamped[i] = max
-		} else {
-			clamped[i] = v
+
+// takeUpParticles removes the particles that enter a cell on infection: one particle of
+// each infecting type, or everything adsorbed at the cell, depending on -particleUptake
+func (g *Grid) takeUpParticles(i, j int, byVirion, byDip bool) {
+	var v, d int
+	switch particleUptake {
+	case "infecting":
+		if byVirion {
+			v = min(1, g.localVirions[i][j])
+		}
+		if byDip {
+			d = min(1, g.localDips[i][j])
 		}
+	case "all":
+		v, d = g.localVirions[i][j], g.localDips[i][j]
 	}
-	return clamped
+	g.localVirions[i][j] -= v
+	g.localDips[i][j] -= d
+	g.virionLedger.consumed += v
+	g.dipLedger.consumed += d
 }
 
-// Modified function definition
-func createInfectionGraph(frameNum int, virionOnly, dipOnly, both []float64, showLegend bool) *image.RGBA {
-	graphWidth := GRID_SIZE * CELL_SIZE * 2
-	graphHeight := 200
-
-	if frameNum < 1 {
-		log.Fatalf("Not enough data to render the graph: frameNum = %d", frameNum)
+// burstSizes returns the virions and DIPs a cell at (i, j) would release on lysis. The
+// DIP burst grows with the DIP-to-virion ratio at the cell and is empty without virions
+// there (unless -legacyDIPBurst restores the partition quirk), or both come from the
+// cell's genomes under the intracellular model. The cell's DIP variants then cut the
+// virion burst by their interference and scale the DIP burst by their advantage, and an
+// active drug scales the virion burst.
+func (g *Grid) burstSizes(i, j int) (int, int) {
+	burstV, burstD := g.strainBurst(i, j), 0
+	if intracellularModel {
+		burstV, burstD = g.genomeBursts(i, j)
+	} else if g.localVirions[i][j] > 0 {
+		dipVirionRatio := float64(g.localDips[i][j]) / float64(g.localVirions[i][j])
+		burstD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
+	} else if legacyDIPBurst && dipSpread.mode == "partition" && dipSpread.kernel == nil {
+		// The original partition release started from BURST_SIZE_D even without virions
+		burstD = BURST_SIZE_D
 	}
+	if len(dipVariants) > 0 {
+		virionFactor, dipFactor := g.dipVariantYield(i, j)
+		burstV = int(math.Round(float64(burstV) * virionFactor))
+		burstD = int(math.Round(float64(burstD) * dipFactor))
+	}
+	if drugBurstFactor != 1 {
+		burstV = int(math.Round(float64(burstV) * drugBurstFactor))
+	}
+	return burstV, burstD
+}
 
-	virionOnly = clampValues(virionOnly, 0.00, yMax)
-	dipOnly = clampValues(dipOnly, 0.00, yMax)
-	both = clampValues(both, 0.00, yMax)
+// releaseBurst spreads the particles of a cell that lyses at (i, j). Under budding
+// release the cell dies without a burst.
+func (g *Grid) releaseBurst(i, j int) {
+	burstV, burstD := 0, 0
+	if releaseMode != "budding" {
+		burstV, burstD = g.burstSizes(i, j)
+		if legacyDIPBurst && !intracellularModel && dipSpread.kernel == nil && (dipSpread.mode == "jumprandomly" || dipSpread.mode == "jumpradius") {
+			// The original jump modes released the DIP burst twice, once with the virions
+			// and once on its own
+			burstD *= 2
+		}
+	}
+	if intracellularModel {
+		g.intraWT[i][j], g.intraDVG[i][j] = 0, 0
+	}
+	g.coinfectionExcluded[i][j] = false
+	g.releaseParticles(i, j, burstV, burstD)
+	g.strainMask[i][j] = 0
+	g.dipVariantMask[i][j] = 0
+}
 
-	// Dynamically set legend name
-	var series []chart.Series
+// releaseBudding sheds particles from an infected cell at (i, j) once its eclipse period
+// is over. Each hour the cell buds buddingRate virions scaled by its burst size, and
+// DIPs in the same proportion, as Poisson draws.
+func (g *Grid) releaseBudding(i, j int) {
+	if releaseMode == "burst" || g.timeSinceInfectVorBoth[i][j] < eclipsePeriod {
+		return
+	}
+	burstV, burstD := g.burstSizes(i, j)
+	perBurst := buddingRate * float64(TIMESTEP) / float64(BURST_SIZE_V)
+	g.releaseParticles(i, j, poissonSample(perBurst*float64(burstV)), poissonSample(perBurst*float64(burstD)))
+}
 
-	series = []chart.Series{
-		chart.ContinuousSeries{
-			Name:    "Infected by Virion Only",
-			XValues: createTimeSeries(frameNum),
-			YValues: virionOnly,
-			Style:   chart.Style{StrokeColor: chart.ColorRed, StrokeWidth: 6.0},
-		},
-		chart.ContinuousSeries{
-			Name:    "Infected by DIP Only",
-			XValues: createTimeSeries(frameNum),
-			YValues: dipOnly,
-			Style:   chart.Style{StrokeColor: chart.ColorGreen, StrokeWidth: 6.0},
-		},
-		chart.ContinuousSeries{
-			Name:    "Infected by Both",
-			XValues: createTimeSeries(frameNum),
-			YValues: both,
-			Style:   chart.Style{StrokeColor: drawing.Color{R: 255, G: 165, B: 0, A: 255}, StrokeWidth: 8.0},
-		},
+// poissonSample draws from a Poisson distribution with the given mean; large means use
+// the normal approximation
+func poissonSample(mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 30 {
+		return int(math.Max(0, math.Round(mean+math.Sqrt(mean)*rand.NormFloat64())))
+	}
+	limit, k, p := math.Exp(-mean), 0, rand.Float64()
+	for p > limit {
+		k++
+		p *= rand.Float64()
 	}
+	return k
+}
 
-	graph := chart.Chart{
-		Width:  GRID_SIZE * CELL_SIZE * 1.51,
-		Height: 100,
-		XAxis: chart.XAxis{
-			Style: chart.Style{FontSize: 10.0},
-			ValueFormatter: func(v interface{}) string {
-				return fmt.Sprintf("%d", int(v.(float64)))
-			},
-			Ticks: generateTicks(xMax, ticksInterval),
-		},
-		YAxis: chart.YAxis{
-			Style: chart.Style{FontSize: 10.0},
-		},
-		Series: series,
+// proliferate lets the live neighbours of the dead site at (i, j) divide into it. The
+// site is filled with probability 1 - exp(-proliferationRate · live fraction · TIMESTEP),
+// where the live fraction counts SUSCEPTIBLE, ANTIVIRAL and REGROWTH neighbours; the
+// parent is a random live neighbour.
+func (g *Grid) proliferate(i, j int, newGrid *[GRID_SIZE][GRID_SIZE]int) {
+	var live [][2]int
+	valid := 0
+	for _, neighbor := range g.neighbors1[i][j] {
+		ni, nj := neighbor[0], neighbor[1]
+		if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
+			continue
+		}
+		valid++
+		switch g.state[ni][nj] {
+		case SUSCEPTIBLE, ANTIVIRAL, REGROWTH:
+			live = append(live, [2]int{ni, nj})
+		}
+	}
+	if len(live) == 0 {
+		return
+	}
+	p := 1 - math.Exp(-proliferationRate*float64(len(live))/float64(valid)*float64(TIMESTEP))
+	if rand.Float64() >= p {
+		return
+	}
+	parent := live[rand.Intn(len(live))]
+	g.cellType[i][j] = g.cellType[parent[0]][parent[1]]
+	newGrid[i][j] = REGROWTH
+	g.timeSinceRegrowth[i][j] = 0
+	g.timeSinceDead[i][j] = -1
+	if regrowthInheritance == "antiviral" && g.state[parent[0]][parent[1]] == ANTIVIRAL {
+		newGrid[i][j] = ANTIVIRAL
+		g.previousStates[i][j] = REGROWTH
+		g.timeSinceAntiviral[i][j] = -2
+		g.antiviralDuration[i][j] = 0
+		if !g.antiviralFlag[i][j] {
+			g.antiviralFlag[i][j] = true
+			g.antiviralCellCount++
+		}
 	}
+}
 
-	buffer := bytes.NewBuffer([]byte{})
-	err := graph.Render(chart.PNG, buffer)
-	if err != nil {
-		log.Fatalf("Failed to render graph: %v", err)
+// readyToRegrow reports whether the dead cell at (i, j) has waited long enough to regrow.
+// The legacy distribution redraws the threshold every step and records the realised
+// wait; the others draw it once per dead cell.
+func (g *Grid) readyToRegrow(i, j int) bool {
+	if regrowthDelay.family == "legacy" {
+		if g.timeSinceDead[i][j] < int(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN) {
+			return false
+		}
+		regrowthDelay.record(g.timeSinceDead[i][j])
+		return true
+	}
+	if g.regrowthThreshold[i][j] == -1 {
+		g.regrowthThreshold[i][j] = regrowthDelay.sample(nil)
 	}
+	if g.timeSinceDead[i][j] < g.regrowthThreshold[i][j] {
+		return false
+	}
+	g.regrowthThreshold[i][j] = -1
+	return true
+}
 
-	graphImg, _, err := image.Decode(buffer)
-	if err != nil {
-		log.Fatalf("Failed to decode graph image: %v", err)
+// excludesSuperinfection reports whether the infected cell at (i, j) is past the
+// superinfection exclusion window and so keeps its current infection; the first
+// blocked co-infection of a cell is counted in excludedCells
+func (g *Grid) excludesSuperinfection(i, j int) bool {
+	if superinfectionExclusion < 0 {
+		return false
+	}
+	sinceInfection := g.timeSinceInfectDIP[i][j]
+	if g.state[i][j] == INFECTED_VIRION {
+		sinceInfection = g.timeSinceInfectVorBoth[i][j]
 	}
+	if sinceInfection < superinfectionExclusion {
+		return false
+	}
+	if !g.coinfectionExcluded[i][j] {
+		g.coinfectionExcluded[i][j] = true
+		g.excludedCells++
+	}
+	return true
+}
 
-	rgbaImg := image.NewRGBA(image.Rect(0, 0, graphWidth, graphHeight))
-	draw.Draw(rgbaImg, rgbaImg.Bounds(), graphImg, image.Point{}, draw.Src)
+// applyDIPOnlyFate ends a DIP-only infection at (i, j) once its sampled fate time is
+// reached: the cell dies without releasing particles or recovers to SUSCEPTIBLE.
+// Cells superinfected to INFECTED_BOTH in this step are left alone.
+func (g *Grid) applyDIPOnlyFate(i, j int, newGrid *[GRID_SIZE][GRID_SIZE]int) {
+	if dipOnlyFate == "persist" || newGrid[i][j] != INFECTED_DIP {
+		return
+	}
+	if g.dipFateThreshold[i][j] == -1 {
+		g.dipFateThreshold[i][j] = dipFateDelay.sample(nil)
+	}
+	if g.timeSinceInfectDIP[i][j] < g.dipFateThreshold[i][j] {
+		return
+	}
+	if dipOnlyFate == "death" {
+		newGrid[i][j] = DEAD
+		g.timeSinceDead[i][j] = 0
+		g.dipOnlyDeaths++
+	} else {
+		newGrid[i][j] = SUSCEPTIBLE
+		g.timeSinceSusceptible[i][j] = 0
+		g.dipOnlyRecoveries++
+	}
+	g.timeSinceInfectDIP[i][j] = -1
+	g.dipFateThreshold[i][j] = -1
+	g.coinfectionExcluded[i][j] = false
+	g.strainMask[i][j] = 0
+	g.dipVariantMask[i][j] = 0
+	g.intraWT[i][j], g.intraDVG[i][j] = 0, 0
+}
 
-	return rgbaImg
+// delayDistribution draws per-cell delays in hours. The legacy family keeps the
+// original untruncated normal of each call site; the others never return less than one
+// hour, so a cell cannot lyse, turn antiviral or regrow without waiting.
+type delayDistribution struct {
+	name     string
+	family   string // "legacy", "normal", "gamma", "lognormal", "erlang" or "fixed"
+	mean, sd float64
+	k        int // Erlang shape
+
+	// realised samples
+	n         int
+	sum, sum2 float64
+	min, max  int
 }
 
-// saveCurrentGoFile saves the current Go source file into the specified output folder.
-// saveCurrentGoFile saves the current Go source file with its original name and a timestamp.
-func saveCurrentGoFile(outputFolder string) {
-	_, currentFile, _, ok := runtime.Caller(0)
-	if !ok {
-		log.Println("Unable to get current Go file path")
-		return
+// parseDelay reads family[:mean[:sd]] (erlang[:mean[:k]], fixed[:hours]); missing
+// parameters default to the legacy mean and standard deviation
+func parseDelay(name, spec string, mean, sd float64) *delayDistribution {
+	parts := strings.Split(spec, ":")
+	d := &delayDistribution{name: name, family: parts[0], mean: mean, sd: sd}
+	var params []float64
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 {
+			log.Fatalf("Bad %s distribution %q: parameters must be numbers >= 0", name, spec)
+		}
+		params = append(params, v)
+	}
+	maxParams := 2
+	switch d.family {
+	case "legacy":
+		maxParams = 0
+	case "fixed":
+		maxParams = 1
+	case "normal", "gamma", "lognormal", "erlang":
+	default:
+		log.Fatalf("Unknown %s distribution %q: want legacy, normal, gamma, lognormal, erlang or fixed", name, spec)
+	}
+	if len(params) > maxParams {
+		log.Fatalf("%s distribution %q takes at most %d parameters", name, spec, maxParams)
+	}
+	if len(params) > 0 {
+		d.mean = params[0]
+	}
+	if d.family == "erlang" {
+		d.k = int(math.Round(d.mean * d.mean / math.Max(d.sd*d.sd, 1e-9)))
+		if len(params) > 1 {
+			d.k = int(params[1])
+		}
+		if d.k < 1 {
+			d.k = 1
+		}
+		d.sd = d.mean / math.Sqrt(float64(d.k))
+	} else if len(params) > 1 {
+		d.sd = params[1]
+	}
+	if d.family == "fixed" {
+		d.sd = 0
 	}
+	if d.family != "legacy" && d.family != "fixed" && (d.mean <= 0 || d.sd <= 0) {
+		log.Fatalf("%s distribution %q needs mean > 0 and sd > 0", name, spec)
+	}
+	return d
+}
 
-	// Get the base name of the current Go file (without path)
-	originalFileName := filepath.Base(currentFile)
+// sample draws one delay; legacy is the call site's original expression
+func (d *delayDistribution) sample(legacy func() int) int {
+	return d.sampleScaled(1, legacy)
+}
 
-	// Generate timestamp
-	timestamp := time.Now().Format("20060102_150405") // Format: YYYYMMDD_HHMMSS
+// sampleScaled draws one delay with a non-legacy distribution stretched by scale (the
+// cell type's mean relative to the global one); legacy ignores scale
+func (d *delayDistribution) sampleScaled(scale float64, legacy func() int) int {
+	var x float64
+	switch d.family {
+	case "legacy":
+		x = float64(legacy())
+		scale = 1
+	case "fixed":
+		x = d.mean
+	case "normal":
+		x = rand.NormFloat64()*d.sd + d.mean
+		for x < 0.5 {
+			x = rand.NormFloat64()*d.sd + d.mean
+		}
+	case "gamma":
+		shape := d.mean * d.mean / (d.sd * d.sd)
+		x = gammaSample(shape) * d.sd * d.sd / d.mean
+	case "lognormal":
+		sigma2 := math.Log(1 + d.sd*d.sd/(d.mean*d.mean))
+		x = math.Exp(math.Log(d.mean) - sigma2/2 + math.Sqrt(sigma2)*rand.NormFloat64())
+	case "erlang":
+		for n := 0; n < d.k; n++ {
+			x += rand.ExpFloat64()
+		}
+		x *= d.mean / float64(d.k)
+	}
+	v := int(math.Round(x * scale))
+	if d.family != "legacy" && v < 1 {
+		v = 1
+	}
+	d.record(v)
+	return v
+}
 
-	// Target filename: original filename_timestamp.go
-	newFileName := fmt.Sprintf("%s_%s.go", originalFileName[:len(originalFileName)-3], timestamp)
-	outputFilePath := filepath.Join(outputFolder, newFileName)
-	// Read Go file content
-	content, err := ioutil.ReadFile(currentFile)
-	if err != nil {
-		log.Printf("cant read file %s: %v\n", currentFile, err)
-		return
+// record adds a realised delay to the summary
+func (d *delayDistribution) record(v int) {
+	if d.n == 0 || v < d.min {
+		d.min = v
 	}
+	if d.n == 0 || v > d.max {
+		d.max = v
+	}
+	d.n++
+	d.sum += float64(v)
+	d.sum2 += float64(v) * float64(v)
+}
 
-	// Ensure target folder exists
-	if err := os.MkdirAll(outputFolder, os.ModePerm); err != nil {
-		log.Printf("cant make outputfolder %s: %v\n", outputFolder, err)
-		return
+// gammaSample draws from Gamma(shape, 1) (Marsaglia and Tsang)
+func gammaSample(shape float64) float64 {
+	if shape < 1 {
+		return gammaSample(shape+1) * math.Pow(rand.Float64(), 1/shape)
 	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rand.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		if u := rand.Float64(); math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
 
-	// Write file
-	err = ioutil.WriteFile(outputFilePath, content, 0644)
+// writeDelaySummary writes the configured and realised delays to delay_summary.csv
+func writeDelaySummary(outputFolder string) {
+	file, err := os.Create(filepath.Join(outputFolder, "delay_summary.csv"))
 	if err != nil {
-		log.Printf("cant save file to %s: %v\n", outputFilePath, err)
-		return
+		log.Fatalf("Failed to create delay summary: %v", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"delay", "family", "mean", "sd", "erlangK", "samples", "sampleMean", "sampleSD", "sampleMin", "sampleMax"})
+	for _, d := range []*delayDistribution{lysisDelay, antiviralDelay, regrowthDelay, dipFateDelay} {
+		mean, sd := 0.0, 0.0
+		if d.n > 0 {
+			mean = d.sum / float64(d.n)
+			sd = math.Sqrt(math.Max(0, d.sum2/float64(d.n)-mean*mean))
+		}
+		writer.Write([]string{d.name, d.family,
+			strconv.FormatFloat(d.mean, 'f', 6, 64), strconv.FormatFloat(d.sd, 'f', 6, 64), strconv.Itoa(d.k),
+			strconv.Itoa(d.n), strconv.FormatFloat(mean, 'f', 6, 64), strconv.FormatFloat(sd, 'f', 6, 64),
+			strconv.Itoa(d.min), strconv.Itoa(d.max)})
+		fmt.Printf("  %s delay (%s): %d samples, mean %.2f h, sd %.2f h, range %d-%d h\n", d.name, d.family, d.n, mean, sd, d.min, d.max)
 	}
+}
 
-	log.Printf("file successfully saved in %s\n", outputFilePath)
+// releaseParticles spreads burstV virions and burstD DIPs from (i, j). Virions and DIPs
+// each follow their own spread settings; with DIP variants, the virions released may
+// first give rise to a de novo variant.
+func (g *Grid) releaseParticles(i, j, burstV, burstD int) {
+	if debugMode {
+		beforeV := sumCounts(&g.localVirions) + g.virionLedger.lostOffGrid + g.virionLedger.lostBlocked
+		beforeD := sumCounts(&g.localDips) + g.dipLedger.lostOffGrid + g.dipLedger.lostBlocked
+		defer func() {
+			if released := sumCounts(&g.localVirions) + g.virionLedger.lostOffGrid + g.virionLedger.lostBlocked - beforeV; released != burstV {
+				log.Fatalf("Burst at (%d, %d) released %d of %d virions", i, j, released, burstV)
+			}
+			if released := sumCounts(&g.localDips) + g.dipLedger.lostOffGrid + g.dipLedger.lostBlocked - beforeD; released != burstD {
+				log.Fatalf("Burst at (%d, %d) released %d of %d DIPs", i, j, released, burstD)
+			}
+		}()
+	}
+	g.virionLedger.produced += burstV
+	g.dipLedger.produced += burstD
+	if len(strains) > 0 {
+		g.spreadStrainVirions(i, j, burstV)
+	} else {
+		g.spreadParticles(i, j, burstV, virionSpread, g.neighborsRingVirion[i][j], &g.localVirions, &g.virionLedger, &g.totalRandomJumpVirions, nil)
+	}
+	if len(dipVariants) > 0 {
+		g.generateDIPVariant(i, j, burstV)
+		g.spreadDIPVariants(i, j, burstD)
+	} else {
+		g.spreadParticles(i, j, burstD, dipSpread, g.neighborsRingDIP[i][j], &g.localDips, &g.dipLedger, &g.totalRandomJumpDIPs, nil)
+	}
 }
 
-func getNextFolderNumber(basePath string) int {
-	files, err := os.ReadDir(basePath)
-	if err != nil {
-		log.Fatalf("Failed to read directory %s: %v", basePath, err)
+// spreadParticles releases n particles of one type from (i, j) into counts
+func (g *Grid) spreadParticles(i, j, n int, s spreadSettings, ring [][2]int, counts *[GRID_SIZE][GRID_SIZE]int, ledger *particleLedger, randomJumps *int, strain *[GRID_SIZE][GRID_SIZE]int) {
+	if s.kernel != nil {
+		for p := 0; p < n; p++ {
+			if ni, nj, ok := s.kernel.sample(i, j); ok {
+				deposit(counts, strain, ni, nj, 1)
+				ledger.deposited++
+			} else {
+				ledger.lostOffGrid++
+			}
+		}
+		return
 	}
 
-	maxNumber := 0
-	for _, file := range files {
-		if file.IsDir() {
-			// Try to parse number from folder name
-			var folderNumber int
-			_, err := fmt.Sscanf(file.Name(), "%d", &folderNumber)
-			if err == nil && folderNumber > maxNumber {
-				maxNumber = folderNumber
+	random := 0
+	switch s.mode {
+	case "jumprandomly":
+		random = n
+	case "partition":
+		random = int(math.Floor(float64(n) * s.kJumpR))
+	case "jumpradius":
+		for p := 0; p < n; p++ {
+			spot := ring[rand.Intn(len(ring))]
+			if spot == [2]int{-1, -1} {
+				ledger.lostOffGrid++
+				continue
 			}
+			deposit(counts, strain, spot[0], spot[1], 1)
+			ledger.deposited++
 		}
+		return
 	}
-	return maxNumber + 1 // Return next available number
+	for p := 0; p < random; p++ {
+		ni, nj := randomCell()
+		deposit(counts, strain, ni, nj, 1)
+		ledger.deposited++
+		*randomJumps++
+	}
+	g.spreadCellToCell(i, j, n-random, counts, ledger, strain)
 }
 
-func transformToLogScale(data []float64) []float64 {
-	transformed := make([]float64, len(data))
-	for i, value := range data {
-		if value > 0 {
-			transformed[i] = math.Log10(value)
+// spreadCellToCell splits n particles over the three neighbour tables with weights
+// 1 : 1/2 : 1/√3 per neighbour. Each neighbour of a table gets an equal integer share
+// and the remainder is sampled, first over the tables by weight and then over the
+// neighbours of a table. Under the legacy deposition policy distance-1 shares only land
+// on susceptible cells; the other policies redirect particles aimed at cells that may not
+// receive them, so only off-grid particles are lost.
+func (g *Grid) spreadCellToCell(i, j, n int, counts *[GRID_SIZE][GRID_SIZE]int, ledger *particleLedger, strain *[GRID_SIZE][GRID_SIZE]int) {
+	if n <= 0 {
+		return
+	}
+	sqrt3 := math.Sqrt(3)
+	ratios := [3]float64{1.0, 1.0 / 2, 1.0 / (3 / sqrt3)}
+	tables := [3]*[GRID_SIZE][GRID_SIZE][6][2]int{&g.neighbors1, &g.neighbors2, &g.neighbors3}
+	totalRatio := ratios[0] + ratios[1] + ratios[2]
+
+	var groups [3]int
+	remaining := n
+	for k := range groups {
+		groups[k] = int(math.Floor(float64(n) * ratios[k] / totalRatio))
+		remaining -= groups[k]
+	}
+	// Randomly distribute the remaining particles based on the ratio
+	for ; remaining > 0; remaining-- {
+		randVal := rand.Float64() * totalRatio
+		if randVal < ratios[0] {
+			groups[0]++
+		} else if randVal < ratios[0]+ratios[1] {
+			groups[1]++
 		} else {
-			transformed[i] = math.Log10(0.0001) // handle log(0) case, use a very small value instead
+			groups[2]++
 		}
 	}
-	return transformed
-}
 
-func createTimeSeries(frameNum int) []float64 {
-	if frameNum < 1 {
-		return []float64{0, 1} // Return a default time series if not enough data
+	// Equal shares per neighbour, the leftover of each table goes to random neighbours
+	var slots [18]int
+	var eligible [][2]int
+	for k, table := range tables {
+		for s := 0; s < 6; s++ {
+			slots[6*k+s] = groups[k] / 6
+		}
+		for _, s := range rand.Perm(6)[:groups[k]%6] {
+			slots[6*k+s]++
+		}
+		for _, nb := range table[i][j] {
+			if nb != [2]int{-1, -1} && g.receivesParticles(nb[0], nb[1]) {
+				eligible = append(eligible, nb)
+			}
+		}
 	}
-
-	timeSeries := make([]float64, frameNum+1)
-	for i := 0; i <= frameNum; i++ {
-		timeSeries[i] = float64(i)
+	for s, c := range slots {
+		nb := tables[s/6][i][j][s%6]
+		switch {
+		case c == 0:
+		case nb == [2]int{-1, -1}:
+			ledger.lostOffGrid += c
+		case depositionPolicy == "legacy":
+			if s < 6 && g.state[nb[0]][nb[1]] != SUSCEPTIBLE {
+				ledger.lostBlocked += c
+			} else {
+				deposit(counts, strain, nb[0], nb[1], c)
+				ledger.deposited += c
+			}
+		case g.receivesParticles(nb[0], nb[1]):
+			deposit(counts, strain, nb[0], nb[1], c)
+			ledger.deposited += c
+		case len(eligible) > 0:
+			for p := 0; p < c; p++ {
+				e := eligible[rand.Intn(len(eligible))]
+				deposit(counts, strain, e[0], e[1], 1)
+			}
+			ledger.deposited += c
+		default:
+			// No neighbour may receive them: the particles stay at the lysing cell
+			deposit(counts, strain, i, j, c)
+			ledger.deposited += c
+		}
 	}
-	return timeSeries
 }
 
-// Function to calculate total virions in the grid
-func (g *Grid) totalVirions() int {
-	totalVirions := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			totalVirions += g.localVirions[i][j]
-		}
+// deposit adds n particles at (i, j) to counts and, for a strain release, to the
+// strain's own field
+func deposit(counts, strain *[GRID_SIZE][GRID_SIZE]int, i, j, n int) {
+	counts[i][j] += n
+	if strain != nil {
+		strain[i][j] += n
 	}
-	return totalVirions
 }
 
-// Function to calculate total DIPs in the grid
-func (g *Grid) totalDIPs() int {
-	totalDIPs := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			totalDIPs += g.localDips[i][j]
-		}
+// receivesParticles reports whether cell-to-cell spread may deposit on (i, j)
+func (g *Grid) receivesParticles(i, j int) bool {
+	switch depositionPolicy {
+	case "live":
+		return g.state[i][j] != DEAD
+	case "susceptible":
+		return g.state[i][j] == SUSCEPTIBLE
 	}
-	return totalDIPs
+	return true
 }
 
-// Function to calculate the total number of regrowth cells in the grid
-func (g *Grid) calculateRegrowthCount() int {
-	regrowthCells := 0
+// Total number of particles in a grid of counts
+func sumCounts(counts *[GRID_SIZE][GRID_SIZE]int) int {
+	total := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == REGROWTH {
-				regrowthCells++
-				g.timeSinceRegrowth[i][j] += TIMESTEP
-			}
+			total += counts[i][j]
 		}
 	}
-	return regrowthCells
+	return total
 }
 
-// Function to calculate the percentage of susceptible cells in the grid
-func (g *Grid) calculateSusceptiblePercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	susceptibleCells := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == SUSCEPTIBLE {
-				susceptibleCells++
-				g.timeSinceSusceptible[i][j] += TIMESTEP
-			}
+// Grid cells within the given hex distance from (i, j), subject to the boundary condition
+func hexDiscCells(i, j, radius int) [][2]int {
+	var cells [][2]int
+	for _, h := range hexDisc(offsetToAxial(i, j), radius) {
+		if ni, nj, ok := resolveCell(axialToOffset(h)); ok {
+			cells = append(cells, [2]int{ni, nj})
 		}
 	}
-	return (float64(susceptibleCells) / float64(totalCells)) * 100
+	return cells
 }
 
-// Function to calculate the percentage of regrowthed or antiviral cells
-func (g *Grid) calculateRegrowthedOrAntiviralPercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	regrowthedOrAntiviralCells := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == REGROWTH || g.state[i][j] == ANTIVIRAL {
-				regrowthedOrAntiviralCells++
-			}
+// Jump targets of (i, j): the whole hex disc of the given radius. Targets the boundary
+// condition rejects stay in the list as {-1, -1}, so particles jumping there are lost.
+func jumpDisc(i, j, radius int) [][2]int {
+	disc := hexDisc(offsetToAxial(i, j), radius)
+	cells := make([][2]int, len(disc))
+	for n, h := range disc {
+		cells[n] = [2]int{-1, -1}
+		if ni, nj, ok := resolveCell(axialToOffset(h)); ok {
+			cells[n] = [2]int{ni, nj}
 		}
 	}
-	return (float64(regrowthedOrAntiviralCells) / float64(totalCells)) * 100
+	return cells
 }
 
-// Function to calculate the percentage of infected cells (both virion and DIP infections)
-func (g *Grid) calculateInfectedPercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	infectedCells := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_DIP || g.state[i][j] == INFECTED_BOTH {
-				infectedCells++
+// Add this new function, based on the competition mechanism from the paper
+
+// Calculate neighbor relationships
+func (g *Grid) initializeNeighbors() {
+
+	// Areas of the IFN species; radius 0 species are spread well-wide and need no area
+	g.ifnSpeciesArea = make([][GRID_SIZE][GRID_SIZE][][2]int, len(ifnSpeciesList))
+	for k, s := range ifnSpeciesList {
+		if s.radius == 0 {
+			continue
+		}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.ifnSpeciesArea[k][i][j] = hexDiscCells(i, j, s.radius)
 			}
 		}
 	}
-	return (float64(infectedCells) / float64(totalCells)) * 100
-}
 
-// Function to calculate the percentage of DIP-only infected cells
-func (g *Grid) calculateInfectedDIPOnlyPercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	infectedDIPOnlyCells := 0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_DIP {
-				infectedDIPOnlyCells++
+			// Initialize the virion and DIP jump targets based on jumpRadiusV and jumpRadiusD
+			g.neighborsRingVirion[i][j] = jumpDisc(i, j, jumpRadiusV)
+			g.neighborsRingDIP[i][j] = jumpDisc(i, j, jumpRadiusD)
+
+			if ifnWave == true {
+				// Initialize neighbors for IFN area
+				g.neighborsIFNArea[i][j] = hexDiscCells(i, j, IFN_wave_radius)
 			}
+
 		}
+
 	}
-	return (float64(infectedDIPOnlyCells) / float64(totalCells)) * 100
-}
 
-// Function to calculate the percentage of cells infected by both virions and DIPs
-func (g *Grid) calculateInfectedBothPercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	infectedBothCells := 0
+	invalidNeighbor := [2]int{-1, -1} // Invalid neighbor coordinate
+
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_BOTH {
-				infectedBothCells++
+			center := offsetToAxial(i, j)
+			for n := 0; n < 6; n++ {
+				targets := [3]hexAxial{
+					center.add(hexDirections[n]),                             // Neighbors at distance 1 (center distance √3 cell sizes)
+					center.add(hexDirections[n].scale(2)),                    // Straight neighbors at distance 2 (center distance 2√3)
+					center.add(hexDirections[n]).add(hexDirections[(n+1)%6]), // Diagonal neighbors at distance 2 (center distance 3)
+				}
+				tables := [3]*[GRID_SIZE][GRID_SIZE][6][2]int{&g.neighbors1, &g.neighbors2, &g.neighbors3}
+				for t, target := range targets {
+					// Off-grid neighbors are invalid unless the boundary maps them back onto the grid
+					if ni, nj, ok := resolveCell(axialToOffset(target)); ok {
+						tables[t][i][j][n] = [2]int{ni, nj}
+					} else {
+						tables[t][i][j][n] = invalidNeighbor
+					}
+				}
 			}
 		}
+
 	}
-	return (float64(infectedBothCells) / float64(totalCells)) * 100
+
+	fmt.Println("Neighbors initialized")
+
 }
 
-// Function to calculate the percentage of antiviral cells (if antiviral state is modeled)
-func (g *Grid) calculateAntiviralPercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	antiviralCells := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == ANTIVIRAL {
-				antiviralCells++
+// decayIFNSpecies applies each species' half-life for one time step
+func (g *Grid) decayIFNSpecies() {
+	for k, s := range ifnSpeciesList {
+		if s.halfLife == 0 {
+			continue
+		}
+		factorIFN := math.Pow(0.5, float64(TIMESTEP)/s.halfLife)
+		threshold := 1.0 / (float64(GRID_SIZE) * float64(GRID_SIZE))
+		if s.radius == 0 {
+			// Well-wide species: threshold the total, as for global IFN
+			threshold /= float64(len(realCells))
+		}
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				g.ifnSpeciesConc[k][i][j] *= factorIFN
+				// Remove IFN if concentration is below threshold
+				if g.ifnSpeciesConc[k][i][j] < threshold {
+					g.ifnSpeciesConc[k][i][j] = 0
+				}
 			}
 		}
 	}
-	return (float64(antiviralCells) / float64(totalCells)) * 100
+	g.syncIFNSpecies()
 }
 
-// Function to calculate the percentage of uninfected cells (susceptible and regrowth cells)
-func (g *Grid) calculateUninfectedPercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	uninfectedCells := 0
+// syncIFNSpecies sets IFNConcentration to the potency-weighted sum of all species,
+// so the antiviral machinery and the IFN renderers see the combined signal
+func (g *Grid) syncIFNSpecies() {
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH {
-				uninfectedCells++
+			total := 0.0
+			for k, s := range ifnSpeciesList {
+				total += s.potency * g.ifnSpeciesConc[k][i][j]
 			}
+			g.IFNConcentration[i][j] = total
 		}
 	}
-	return (float64(uninfectedCells) / float64(totalCells)) * 100
 }
 
-// Function to calculate plaque percentage (for simplicity, counting dead cells as plaques)
-func (g *Grid) calculatePlaquePercentage() float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	plaqueCells := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == DEAD {
-				plaqueCells++
-			}
+// regionalIFNSpecies returns the potency-weighted IFN signal seen by cell (i, j),
+// averaging each species over its own area
+func (g *Grid) regionalIFNSpecies(i, j int) float64 {
+	signal := 0.0
+	for k, s := range ifnSpeciesList {
+		if s.radius == 0 {
+			signal += s.potency * g.ifnSpeciesConc[k][i][j]
+			continue
+		}
+		area := g.ifnSpeciesArea[k][i][j]
+		if len(area) == 0 {
+			continue
 		}
+		sum := 0.0
+		for _, neighbor := range area {
+			sum += g.ifnSpeciesConc[k][neighbor[0]][neighbor[1]]
+		}
+		signal += s.potency * sum / float64(len(area))
 	}
-	return (float64(plaqueCells) / float64(totalCells)) * 100
+	return signal
 }
 
-// Function to calculate the percentage of dead cells
-func calculateDeadCellPercentage(grid [GRID_SIZE][GRID_SIZE]int) float64 {
-	totalCells := GRID_SIZE * GRID_SIZE
-	deadCells := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if grid[i][j] == DEAD {
-				deadCells++
+// produceIFNSpecies lets an infected cell secrete every IFN species once past IFN_DELAY
+func (g *Grid) produceIFNSpecies(i, j int) {
+	if g.profile(i, j).tau <= 0 {
+		return
+	}
+	var sinceInfection int
+	switch g.state[i][j] {
+	case INFECTED_VIRION, INFECTED_BOTH:
+		sinceInfection = g.timeSinceInfectVorBoth[i][j]
+	case INFECTED_DIP:
+		sinceInfection = g.timeSinceInfectDIP[i][j]
+	default:
+		return
+	}
+	if sinceInfection <= IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) {
+		return
+	}
+
+	for k, s := range ifnSpeciesList {
+		var rate float64
+		switch g.state[i][j] {
+		case INFECTED_VIRION:
+			rate = s.prodV
+		case INFECTED_DIP:
+			rate = s.prodD
+		case INFECTED_BOTH:
+			rate = s.prodBoth
+		}
+		totalIncreaseAmount := rate * float64(TIMESTEP) * g.ifnScale(i, j)
+		if totalIncreaseAmount <= 0 {
+			continue
+		}
+
+		if s.radius == 0 {
+			averageIncreaseAmount := totalIncreaseAmount / float64(len(realCells))
+			for _, c := range realCells {
+				g.ifnSpeciesConc[k][c[0]][c[1]] += averageIncreaseAmount
+			}
+		} else {
+			area := g.ifnSpeciesArea[k][i][j]
+			if len(area) == 0 {
+				continue
+			}
+			averageIncreaseAmount := totalIncreaseAmount / float64(len(area))
+			for _, neighbor := range area {
+				g.ifnSpeciesConc[k][neighbor[0]][neighbor[1]] += averageIncreaseAmount
 			}
 		}
+		// Global IFN tracks the antiviral signal, so each species counts by its potency
+		globalIFN += s.potency * totalIncreaseAmount
 	}
-	return (float64(deadCells) / float64(totalCells)) * 100
 }
 
-// Function to calculate the number of cells infected by virion only
-func (g *Grid) calculateVirionOnlyInfected() int {
-	virionOnlyInfected := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_VIRION {
-				virionOnlyInfected++
-			}
+// ifnSpeciesIndex returns the index of the named IFN species, or -1
+func ifnSpeciesIndex(name string) int {
+	for k, s := range ifnSpeciesList {
+		if s.name == name {
+			return k
 		}
 	}
-	return virionOnlyInfected
+	return -1
 }
 
-// Function to calculate the number of cells infected by DIP only
-func (g *Grid) calculateDipOnlyInfected() int {
-	dipOnlyInfected := 0
+// Total amount of one IFN species in the grid
+func (g *Grid) totalIFNSpecies(k int) float64 {
+	total := 0.0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_DIP {
-				dipOnlyInfected++
-			}
+			total += g.ifnSpeciesConc[k][i][j]
 		}
 	}
-	return dipOnlyInfected
+	return total
 }
 
-// Function to calculate the number of cells infected by both virion and DIP
-func (g *Grid) calculateBothInfected() int {
-	bothInfected := 0
-	for i := 0; i < GRID_SIZE; i++ {
-		for j := 0; j < GRID_SIZE; j++ {
-			if g.state[i][j] == INFECTED_BOTH {
-				bothInfected++
-			}
+// applyIFNDoses adds the exogenous IFN scheduled for this time step
+func (g *Grid) applyIFNDoses(frameNum int) {
+	for _, d := range ifnDoses {
+		if d.time != frameNum {
+			continue
 		}
+		treatedCells := g.addIFNDose(d)
+		fmt.Printf("Time step %d: exogenous IFN dose %.2f added to %d cells\n", frameNum, d.conc, treatedCells)
 	}
-	return bothInfected
 }
 
-var precomputedRing [][2]int
+// addIFNDose adds an exogenous IFN dose to its cells and returns how many were treated
+func (g *Grid) addIFNDose(d ifnDose) int {
+	cells := d.cells
+	if cells == nil {
+		cells = realCells
+	}
+	for _, c := range cells {
+		g.exogenousIFN[c[0]][c[1]] += d.conc
+	}
+	return len(cells)
+}
+
+// Timed event of the -interventions schedule. A wash removes fraction of the
+// extracellular particles; a drug scales the cells' rho and the virion burst size by
+// rho and burst from time until until; an ifn event adds an exogenous IFN dose; an
+// overlay changes the spread settings of the virions, the DIPs or both from time on.
+type intervention struct {
+	kind     string // "wash", "drug", "ifn" or "overlay"
+	spec     string
+	time     int
+	until    int
+	fraction float64
+	rho      float64
+	burst    float64
+	dose     ifnDose
+	target   string // overlay: "virions", "dips" or "both"
+	mode     string // overlay settings; empty, or -1 for radius and kJumpR, keeps the current value
+	radius   int
+	kJumpR   float64
+	kernel   string
+	effect   string // what the event did, for interventions.csv
+}
+
+var (
+	interventions   []intervention
+	drugRhoFactor   = 1.0     // product of the active drugs' rho factors
+	drugBurstFactor = 1.0     // product of the active drugs' burst factors
+	baseProfileRho  []float64 // the cell types' rho without drugs
+)
 
-func precomputeRing(radius int) [][2]int {
-	var offsets [][2]int
-	for dx := -radius; dx <= radius; dx++ {
-		for dy := -radius; dy <= radius; dy++ {
-			if dx*dx+dy*dy <= radius*radius {
-				offsets = append(offsets, [2]int{dx, dy})
+// parseInterventions parses the -interventions spec
+func parseInterventions(spec string) []intervention {
+	var list []intervention
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, params, _ := strings.Cut(entry, ",")
+		e := intervention{kind: strings.TrimSpace(kind), spec: entry, time: -1, until: TIME_STEPS, fraction: 1, rho: 1, burst: 1,
+			target: "both", radius: -1, kJumpR: -1}
+		if e.kind == "ifn" {
+			doses := parseIFNDoses(params)
+			if len(doses) != 1 {
+				log.Fatalf("Intervention %q needs t= and conc=", entry)
+			}
+			e.dose, e.time = doses[0], doses[0].time
+		} else {
+			for _, kv := range strings.Split(params, ",") {
+				key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+				if !ok {
+					log.Fatalf("Invalid intervention parameter %q in %q", kv, entry)
+				}
+				switch key {
+				case "target":
+					e.target = value
+				case "mode":
+					e.mode = value
+				case "kernel":
+					e.kernel = value
+				case "t", "until", "radius":
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 0 {
+						log.Fatalf("Invalid value for %s in intervention %q", key, entry)
+					}
+					switch key {
+					case "t":
+						e.time = n
+					case "until":
+						e.until = n
+					default:
+						e.radius = n
+					}
+				case "fraction", "rho", "burst", "kJumpR":
+					x, err := strconv.ParseFloat(value, 64)
+					if err != nil || x < 0 || (key == "fraction" || key == "kJumpR") && x > 1 {
+						log.Fatalf("Invalid value for %s in intervention %q", key, entry)
+					}
+					switch key {
+					case "fraction":
+						e.fraction = x
+					case "rho":
+						e.rho = x
+					case "burst":
+						e.burst = x
+					default:
+						e.kJumpR = x
+					}
+				default:
+					log.Fatalf("Unknown intervention parameter %q in %q", key, entry)
+				}
+			}
+		}
+		switch e.kind {
+		case "wash", "ifn":
+		case "drug":
+			if e.until <= e.time {
+				log.Fatalf("Intervention %q: until must be after t", entry)
+			}
+		case "overlay":
+			if e.target != "virions" && e.target != "dips" && e.target != "both" {
+				log.Fatalf("Intervention %q: target must be virions, dips or both", entry)
 			}
+			if e.mode == "" && e.kernel == "" && e.radius < 0 && e.kJumpR < 0 {
+				log.Fatalf("Intervention %q needs mode=, radius=, kJumpR= or kernel=", entry)
+			}
+			// Validate the given settings; the rest are checked when they were first set
+			spreadSettings{mode: "celltocell"}.overlay(&e, 0)
+		default:
+			log.Fatalf("Unknown intervention %q: want wash, drug, ifn or overlay", e.kind)
+		}
+		if e.time < 0 || e.time >= TIME_STEPS {
+			log.Fatalf("Intervention %q needs t= in [0, %d)", entry, TIME_STEPS)
 		}
+		list = append(list, e)
 	}
-	rand.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
-	return offsets
+	return list
 }
 
-func precomputeIFNArea(radius int) [][2]int {
-	var area [][2]int
-	for di := -radius; di <= radius; di++ {
-		for dj := -radius; dj <= radius; dj++ {
-			distance := math.Sqrt(float64(di*di + dj*dj))
-			// Include only cells within the radius
-			if distance <= float64(radius) {
-				area = append(area, [2]int{di, dj})
+// applyInterventions applies the events scheduled for this time step, including the
+// end of drug windows
+func (g *Grid) applyInterventions(frameNum int) {
+	for n := range interventions {
+		e := &interventions[n]
+		if e.kind == "drug" && e.until == frameNum {
+			fmt.Printf("Time step %d: drug window of %q ends\n", frameNum, e.spec)
+		}
+		if e.time != frameNum {
+			continue
+		}
+		switch e.kind {
+		case "wash":
+			v, d := g.wash(1 - e.fraction)
+			e.effect = fmt.Sprintf("removed %d virions and %d DIPs", v, d)
+		case "drug":
+			e.effect = fmt.Sprintf("rho x%g and virion burst x%g until t=%d", e.rho, e.burst, e.until)
+		case "ifn":
+			e.effect = fmt.Sprintf("IFN %g added to %d cells", e.dose.conc, g.addIFNDose(e.dose))
+		case "overlay":
+			var effects []string
+			if e.target != "dips" {
+				virionSpread = virionSpread.overlay(e, *flag_jumpRadiusV)
+				jumpRadiusV, allowVirionJump = virionSpread.radius, virionSpread.mode != "celltocell"
+				g.setJumpDiscs(&g.neighborsRingVirion, jumpRadiusV)
+				effects = append(effects, "virions "+virionSpread.describe())
 			}
+			if e.target != "virions" {
+				dipSpread = dipSpread.overlay(e, *flag_jumpRadiusD)
+				jumpRadiusD, allowDIPJump = dipSpread.radius, dipSpread.mode != "celltocell"
+				g.setJumpDiscs(&g.neighborsRingDIP, jumpRadiusD)
+				effects = append(effects, "DIPs "+dipSpread.describe())
+			}
+			e.effect = strings.Join(effects, "; ")
 		}
+		fmt.Printf("Time step %d: intervention %q: %s\n", frameNum, e.spec, e.effect)
 	}
-	return area
+	updateDrugs(frameNum)
 }
 
-// Add this new function, based on the competition mechanism from the paper
-
-// Calculate neighbor relationships
-func (g *Grid) initializeNeighbors() {
-
-	precomputedRingV := precomputeRing(jumpRadiusV)
-	precomputedRingD := precomputeRing(jumpRadiusD)
+// updateDrugs sets the drug factors to the product of the drugs active at frameNum and
+// scales the cell types' rho by the rho factor
+func updateDrugs(frameNum int) {
+	rho, burst := 1.0, 1.0
+	for _, e := range interventions {
+		if e.kind == "drug" && e.time <= frameNum && frameNum < e.until {
+			rho *= e.rho
+			burst *= e.burst
+		}
+	}
+	if rho != drugRhoFactor {
+		if baseProfileRho == nil {
+			for _, c := range cellProfiles {
+				baseProfileRho = append(baseProfileRho, c.rho)
+			}
+		}
+		for k := range cellProfiles {
+			cellProfiles[k].rho = baseProfileRho[k] * rho
+		}
+	}
+	drugRhoFactor, drugBurstFactor = rho, burst
+}
 
+// wash lets each extracellular particle stay with probability keep, strain and
+// variant fields included, and returns the virions and DIPs removed
+func (g *Grid) wash(keep float64) (int, int) {
+	beforeV, beforeD := g.totalVirions(), g.totalDIPs()
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
-			// Initialize the virion neighbors based on jumpRadiusV
-
-			///////////////////////////////////////////
-			indexV := 0
-			for _, offset := range precomputedRingV {
-				newI, newJ := i+offset[0], j+offset[1]
-				// Ensure the new indices are within bounds
-				if newI >= 0 && newI < GRID_SIZE && newJ >= 0 && newJ < GRID_SIZE {
-					g.neighborsRingVirion[i][j][indexV] = [2]int{newI, newJ}
-					indexV++
-				}
-
-				// Stop if we have filled all available spots
-				if indexV >= len(g.neighborsRingVirion[i][j]) {
-					break
+			if len(strains) > 0 {
+				g.localVirions[i][j] = 0
+				for k := range strains {
+					g.strainVirions[k][i][j] = binomialSample(g.strainVirions[k][i][j], keep)
+					g.localVirions[i][j] += g.strainVirions[k][i][j]
 				}
+			} else {
+				g.localVirions[i][j] = binomialSample(g.localVirions[i][j], keep)
 			}
-			for ; indexV < len(g.neighborsRingVirion[i][j]); indexV++ {
-				g.neighborsRingVirion[i][j][indexV] = [2]int{-1, -1}
-			}
-
-			// Initialize the DIP neighbors based on jumpRadiusD
-			indexD := 0
-			for _, offset := range precomputedRingD {
-				newI, newJ := i+offset[0], j+offset[1]
-				// Ensure the new indices are within bounds
-				if newI >= 0 && newI < GRID_SIZE && newJ >= 0 && newJ < GRID_SIZE {
-					g.neighborsRingDIP[i][j][indexD] = [2]int{newI, newJ}
-					indexD++
-				}
-				// Stop if we have filled all available spots
-				if indexD >= len(g.neighborsRingDIP[i][j]) {
-					break
+			if len(dipVariants) > 0 {
+				g.localDips[i][j] = 0
+				for k := range dipVariants {
+					g.dipVariantDips[k][i][j] = binomialSample(g.dipVariantDips[k][i][j], keep)
+					g.localDips[i][j] += g.dipVariantDips[k][i][j]
 				}
+			} else {
+				g.localDips[i][j] = binomialSample(g.localDips[i][j], keep)
 			}
+		}
+	}
+	removedV, removedD := beforeV-g.totalVirions(), beforeD-g.totalDIPs()
+	g.virionLedger.washed += removedV
+	g.dipLedger.washed += removedD
+	return removedV, removedD
+}
 
-			for ; indexD < len(g.neighborsRingDIP[i][j]); indexD++ {
-				g.neighborsRingDIP[i][j][indexD] = [2]int{-1, -1}
-			}
+// binomialSample counts the successes in n trials of probability p
+func binomialSample(n int, p float64) int {
+	k := 0
+	for t := 0; t < n; t++ {
+		if rand.Float64() < p {
+			k++
+		}
+	}
+	return k
+}
 
-			if ifnWave == true {
+// interventionMarks returns the times up to frameNum at which an intervention started,
+// or a drug window ended, for marking on the infection graph
+func interventionMarks(frameNum int) []float64 {
+	var marks []float64
+	for _, e := range interventions {
+		if e.time <= frameNum {
+			marks = append(marks, float64(e.time))
+		}
+		if e.kind == "drug" && e.until <= frameNum {
+			marks = append(marks, float64(e.until))
+		}
+	}
+	return marks
+}
 
-				precomputedIFNArea := precomputeIFNArea(IFN_wave_radius)
-				// Initialize neighbors for IFN area
-				var ifnAreaNeighbors [][2]int
-				for _, offset := range precomputedIFNArea {
-					newI, newJ := i+offset[0], j+offset[1]
-					// Ensure the new indices are within grid bounds
-					if newI >= 0 && newI < GRID_SIZE && newJ >= 0 && newJ < GRID_SIZE {
-						ifnAreaNeighbors = append(ifnAreaNeighbors, [2]int{newI, newJ})
-					}
-				}
-				g.neighborsIFNArea[i][j] = ifnAreaNeighbors
+// writeInterventions lists the scheduled interventions and their effects in
+// interventions.csv
+func writeInterventions(outputFolder string) {
+	if len(interventions) == 0 {
+		return
+	}
+	file, err := os.Create(filepath.Join(outputFolder, "interventions.csv"))
+	if err != nil {
+		log.Fatalf("Failed to create intervention CSV file: %v", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"time", "until", "kind", "spec", "effect"})
+	for _, e := range interventions {
+		until := ""
+		if e.kind == "drug" {
+			until = strconv.Itoa(e.until)
+		}
+		writer.Write([]string{strconv.Itoa(e.time), until, e.kind, e.spec, e.effect})
+	}
+}
 
+// decayExogenousIFN applies the exogenous IFN half-life for one time step
+func (g *Grid) decayExogenousIFN() {
+	if exoIFNHalfLife == 0 {
+		return
+	}
+	factorIFN := math.Pow(0.5, float64(TIMESTEP)/exoIFNHalfLife)
+	for i := 0; i < GRID_SIZE; i++ {
+		for j := 0; j < GRID_SIZE; j++ {
+			g.exogenousIFN[i][j] *= factorIFN
+			if g.exogenousIFN[i][j] < (1.0 / (float64(GRID_SIZE) * float64(GRID_SIZE))) {
+				g.exogenousIFN[i][j] = 0
 			}
-
 		}
-
 	}
+}
 
-	invalidNeighbor := [2]int{-1, -1} // Invalid neighbor coordinate
-
+// Total exogenous IFN in the grid
+func (g *Grid) totalExogenousIFN() float64 {
+	total := 0.0
 	for i := 0; i < GRID_SIZE; i++ {
 		for j := 0; j < GRID_SIZE; j++ {
+			total += g.exogenousIFN[i][j]
+		}
+	}
+	return total
+}
 
-			if i%2 == 0 && j%2 == 0 {
-				// Even centerX, even centerY
-				// Neighbors at distance 1
-				g.neighbors1[i][j] = [6][2]int{
-					{i - 1, j},     // left up
-					{i + 1, j},     // right up
-					{i, j - 1},     // up
-					{i, j + 1},     // down
-					{i - 1, j + 1}, // left down
-					{i + 1, j + 1}, // right down
-				}
-				// Neighbors at distance 2
-				g.neighbors2[i][j] = [6][2]int{
-					{i, j - 2},     // up
-					{i, j + 2},     // down
-					{i - 2, j - 1}, // left up
-					{i + 2, j - 1}, // right up
-					{i - 2, j + 1}, // left down
-					{i + 2, j + 1}, // right down
-				}
-				// Neighbors at distance 3
-				g.neighbors3[i][j] = [6][2]int{
-					{i - 2, j},     // left
-					{i + 2, j},     // right
-					{i - 1, j - 1}, // up left
-					{i + 1, j - 1}, // up right
-					{i - 1, j - 2}, // up left
-					{i + 1, j - 2}, // up right
-				}
-			} else if i%2 == 1 && j%2 == 0 {
-				// Odd centerX, even centerY
-				g.neighbors1[i][j] = [6][2]int{
-					{i - 1, j},     // left up
-					{i + 1, j},     // right up
-					{i, j - 1},     // up
-					{i, j + 1},     // down
-					{i - 1, j + 1}, // left down
-					{i + 1, j + 1}, // right down
-				}
-				g.neighbors2[i][j] = [6][2]int{
-					{i, j - 2},     // up
-					{i, j + 2},     // down
-					{i - 2, j - 1}, // left up
-					{i + 2, j - 1}, // right up
-					{i - 2, j + 1}, // left down
-					{i + 2, j + 1}, // right down
-				}
-				g.neighbors3[i][j] = [6][2]int{
-					{i - 2, j},     // left
-					{i + 2, j},     // right
-					{i - 1, j - 1}, // up left
-					{i + 1, j - 1}, // up right
-					{i - 1, j + 2}, // down left
-					{i + 1, j + 2}, // down right
-				}
-			} else if i%2 == 0 && j%2 == 1 {
-				// Even centerX, odd centerY
-				g.neighbors1[i][j] = [6][2]int{
-					{i - 1, j},     // left up
-					{i + 1, j},     // right up
-					{i, j - 1},     // up
-					{i, j + 1},     // down
-					{i - 1, j + 1}, // left down
-					{i + 1, j + 1}, // right down
-				}
-				g.neighbors2[i][j] = [6][2]int{
-					{i, j - 2},     // up
-					{i, j + 2},     // down
-					{i - 2, j - 1}, // left up
-					{i + 2, j - 1}, // right up
-					{i - 2, j + 1}, // left down
-					{i + 2, j + 1}, // right down
-				}
-				g.neighbors3[i][j] = [6][2]int{
-					{i - 2, j},     // left
-					{i + 2, j},     // right
-					{i - 1, j - 1}, // up left
-					{i + 1, j - 1}, // up right
-					{i - 1, j - 2}, // down left
-					{i + 1, j - 2}, // down right
-				}
-			} else if i%2 == 1 && j%2 == 1 {
-				// Odd centerX, odd centerY
-				g.neighbors1[i][j] = [6][2]int{
-					{i - 1, j}, {i + 1, j}, {i, j - 1}, {i, j + 1}, {i - 1, j + 1}, {i + 1, j + 1},
-				}
-				g.neighbors2[i][j] = [6][2]int{
-					{i, j - 2}, {i, j + 2}, {i - 2, j - 1}, {i + 2, j - 1}, {i - 2, j + 1}, {i + 2, j + 1},
-				}
-				g.neighbors3[i][j] = [6][2]int{
-					{i - 2, j}, {i + 2, j}, {i - 1, j - 1}, {i + 1, j - 1}, {i - 1, j + 2}, {i + 1, j + 2},
-				}
-			}
+// firstIFNDoseTime returns the earliest pretreatment time, or 0 if no dose is given before infection
+func firstIFNDoseTime() int {
+	first := 0
+	for _, d := range ifnDoses {
+		if d.time < first {
+			first = d.time
+		}
+	}
+	return first
+}
 
-			// Remove neighbors that are out of bounds by setting them to invalid values
-			for n := 0; n < 6; n++ {
-				if g.neighbors1[i][j][n][0] < 0 || g.neighbors1[i][j][n][0] >= GRID_SIZE || g.neighbors1[i][j][n][1] < 0 || g.neighbors1[i][j][n][1] >= GRID_SIZE {
-					g.neighbors1[i][j][n] = invalidNeighbor
-				}
-				if g.neighbors2[i][j][n][0] < 0 || g.neighbors2[i][j][n][0] >= GRID_SIZE || g.neighbors2[i][j][n][1] < 0 || g.neighbors2[i][j][n][1] >= GRID_SIZE {
-					g.neighbors2[i][j][n] = invalidNeighbor
-				}
-				if g.neighbors3[i][j][n][0] < 0 || g.neighbors3[i][j][n][0] >= GRID_SIZE || g.neighbors3[i][j][n][1] < 0 || g.neighbors3[i][j][n][1] >= GRID_SIZE {
-					g.neighbors3[i][j][n] = invalidNeighbor
-				}
+// pretreat advances the uninfected well by one hour before infection: exogenous IFN is
+// dosed and decays, and exposed cells progress towards the antiviral state. Nothing
+// else runs, so no particles move and the ledgers stay empty until time 0.
+func (g *Grid) pretreat(frameNum int) {
+	g.frameNum = frameNum
+	newGrid := g.state
+	g.applyIFNDoses(frameNum)
+	for _, c := range realCells {
+		i, j := c[0], c[1]
+		p := g.profile(i, j)
+		if g.state[i][j] != SUSCEPTIBLE && g.state[i][j] != REGROWTH {
+			continue
+		}
+		if g.exogenousIFN[i][j] <= 0 || p.antiviralTAU <= 0 {
+			continue
+		}
+		if g.antiviralDuration[i][j] <= -1 {
+			g.antiviralDuration[i][j] = antiviralDelay.sampleScaled(p.antiviralScale(), func() int {
+				return int(rand.NormFloat64()*float64(p.antiviralTAU)/4 + float64(p.antiviralTAU))
+			})
+			g.timeSinceAntiviral[i][j] = 0
+		} else if g.timeSinceAntiviral[i][j] <= g.antiviralDuration[i][j] {
+			g.timeSinceAntiviral[i][j] += TIMESTEP
+		} else {
+			g.previousStates[i][j] = g.state[i][j]
+			newGrid[i][j] = ANTIVIRAL
+			g.timeSinceAntiviral[i][j] = -2
+			g.totalAntiviralTime += g.antiviralDuration[i][j]
+			if !g.antiviralFlag[i][j] {
+				g.antiviralFlag[i][j] = true
+				g.antiviralCellCount++
 			}
 		}
-
 	}
-
-	fmt.Println("Neighbors initialized")
-
+	g.state = newGrid
+	g.decayExogenousIFN()
 }
 
 // Update the state of the grid at each time step
 func (g *Grid) update(frameNum int) {
+	g.frameNum = frameNum
 	newGrid := g.state
+	g.applyIFNDoses(frameNum)
+	g.applyInterventions(frameNum)
+	g.replicateGenomes()
 
 	if ifnWave == true {
 		for i := 0; i < GRID_SIZE; i++ {
@@ -1113,15 +4071,20 @@ func (g *Grid) update(frameNum int) {
 		}
 		fmt.Printf("Global IFN concentration: %.2f\n", globalIFN)
 
+		if len(ifnSpeciesList) > 0 {
+			g.decayIFNSpecies()
+		}
+
 		// Traverse the grid
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
+				p := g.profile(i, j)
 				// Only consider cells that are in the SUSCEPTIBLE or REGROWTH state
 
 				var regional_sumIFN float64
 				neighborsCount := len(g.neighborsIFNArea[i][j])
 
-				if ifn_half_life != 0 {
+				if ifn_half_life != 0 && len(ifnSpeciesList) == 0 {
 					for i := 0; i < GRID_SIZE; i++ {
 						for j := 0; j < GRID_SIZE; j++ {
 							// Update IFN amount using half-life formula
@@ -1149,12 +4112,17 @@ func (g *Grid) update(frameNum int) {
 				} else {
 					regionalAverageIFN = 0 // Default to 0 if no neighbors, though this should rarely occur
 				}
+				if len(ifnSpeciesList) > 0 {
+					regionalAverageIFN = g.regionalIFNSpecies(i, j)
+				}
 
 				if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH || g.state[i][j] == INFECTED_DIP {
-					if g.IFNConcentration[i][j] > 0 && TAU > 0 {
+					if g.IFNConcentration[i][j]+g.exogenousIFN[i][j] > 0 && p.antiviralTAU > 0 {
 
 						if g.antiviralDuration[i][j] <= -1 {
-							g.antiviralDuration[i][j] = int(rand.NormFloat64()*float64(TAU)/4 + float64(TAU))
+							g.antiviralDuration[i][j] = antiviralDelay.sampleScaled(p.antiviralScale(), func() int {
+								return int(rand.NormFloat64()*float64(p.antiviralTAU)/4 + float64(p.antiviralTAU))
+							})
 							g.timeSinceAntiviral[i][j] = 0
 						} else if g.timeSinceAntiviral[i][j] <= int(g.antiviralDuration[i][j]) {
 							g.timeSinceAntiviral[i][j] += TIMESTEP
@@ -1177,21 +4145,21 @@ func (g *Grid) update(frameNum int) {
 						// Check if the cell is infected by virions or DIPs
 						if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
 							// Calculate the infection probabilities
-							if R == 0 || TAU == 0 {
-								perParticleInfectionChance_V = RHO
+							if R == 0 || p.tau == 0 {
+								perParticleInfectionChance_V = p.rho
 							} else if VStimulateIFN == true && R > 0 { // R=1
-								perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(regionalAverageIFN/float64(R)))
+								perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(regionalAverageIFN/float64(R)))
 							} else if !VStimulateIFN { // usually only DIP stimulate IFN in this situlation
-								perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(regionalAverageIFN))
+								perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(regionalAverageIFN))
 							}
 							var probabilityVInfection, probabilityDInfection float64
 
 							// Virion infection probability
-							probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
+							probabilityVInfection = g.virionInfectionProbability(i, j, perParticleInfectionChance_V)
 							infectedByVirion := rand.Float64() <= probabilityVInfection
 
 							// DIP infection probability
-							probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(regionalAverageIFN))), float64(g.localDips[i][j]))
+							probabilityDInfection = 1 - math.Pow(1-(p.rho*math.Exp(-ALPHA*(regionalAverageIFN))), float64(g.localDips[i][j]))
 							infectedByDip := rand.Float64() <= probabilityDInfection
 
 							// Determine the infection state based on virion and DIP infection
@@ -1208,6 +4176,12 @@ func (g *Grid) update(frameNum int) {
 								g.timeSinceSusceptible[i][j] = -1
 								g.timeSinceRegrowth[i][j] = -1
 							}
+							if newGrid[i][j] != g.state[i][j] {
+								g.takeUpParticles(i, j, infectedByVirion, infectedByDip)
+								g.seedGenomes(i, j, infectedByVirion, infectedByDip)
+							}
+							g.infectStrain(i, j, infectedByVirion, perParticleInfectionChance_V, newGrid[i][j] != g.state[i][j])
+							g.infectDIPVariant(i, j, infectedByDip, newGrid[i][j] != g.state[i][j])
 						}
 
 						// Mark the state as changed if the cell is infected
@@ -1224,6 +4198,7 @@ func (g *Grid) update(frameNum int) {
 		// Process infected cells
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
+				p := g.profile(i, j)
 
 				var regional_sumIFN float64
 
@@ -1240,10 +4215,15 @@ func (g *Grid) update(frameNum int) {
 					// update infected by V or BOTH cells become dead
 					if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
 						if g.lysisThreshold[i][j] == -1 {
-							g.lysisThreshold[i][j] = int(rand.NormFloat64()*STANDARD_LYSIS_TIME + MEAN_LYSIS_TIME)
+							lysis := g.lysisMean(i, j)
+							g.lysisThreshold[i][j] = lysisDelay.sampleScaled(lysis/MEAN_LYSIS_TIME, func() int {
+								return int(rand.NormFloat64()*lysis/4 + lysis)
+							})
 						}
 						g.timeSinceInfectVorBoth[i][j] += TIMESTEP
 						g.timeSinceInfectDIP[i][j] = -1
+						g.dipFateThreshold[i][j] = -1
+						g.releaseBudding(i, j)
 
 						// Check if the cell should lyse and release virions and DIPs
 						if g.lysisThreshold[i][j] > 0 && g.timeSinceInfectVorBoth[i][j] >= g.lysisThreshold[i][j] {
@@ -1254,390 +4234,16 @@ func (g *Grid) update(frameNum int) {
 							} else if g.state[i][j] == INFECTED_BOTH {
 								totalDeadFromBoth++ // Increase INFECTED_BOTH death count
 							}
-
-							newGrid[i][j] = DEAD
-							g.state[i][j] = DEAD
-							g.timeSinceDead[i][j] = 0
-							g.timeSinceInfectVorBoth[i][j] = -1
-							g.timeSinceInfectDIP[i][j] = -1
-							g.lysisThreshold[i][j] = -1
-
-							////////// work on percentage of jump randomly and percentage of spread cell to cell without jump
-							///////////// for k_jumpR percent cells that jump reandomly
-							if par_celltocell_random == true {
-								// Calculate adjusted burst size for DIPs based on local ratio
-								totalVirionsAtCell := g.localVirions[i][j]
-								totalDIPsAtCell := g.localDips[i][j]
-								adjustedBurstSizeD := BURST_SIZE_D
-								if totalVirionsAtCell > 0 {
-									dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-									adjustedBurstSizeD += int(float64(BURST_SIZE_D) * dipVirionRatio)
-								}
-								//  ---------------------------------------
-								// Partition mode: split particles between random jump and cell-to-cell
-								randomVirions := int(math.Floor(float64(BURST_SIZE_V) * k_JumpR))
-								virionsForLocalDiffusion := BURST_SIZE_V - randomVirions
-
-								randomDIPs := int(math.Floor(float64(adjustedBurstSizeD) * k_JumpR))
-								dipsForLocalDiffusion := adjustedBurstSizeD - randomDIPs
-
-								// Handle random jumps
-								for v := 0; v < randomVirions; v++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localVirions[ni][nj]++
-									g.totalRandomJumpVirions++
-								}
-								for d := 0; d < randomDIPs; d++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localDips[ni][nj]++
-									g.totalRandomJumpDIPs++
-								}
-
-								// Handle local diffusion
-								// Handle local diffusion with localVirions & localDIPs (keep original logic unchanged)
-								if virionsForLocalDiffusion > 0 || dipsForLocalDiffusion > 0 {
-									// Calculate the total number of valid neighbors
-									totalNeighbors := 0
-
-									// Count valid neighbors from neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-
-									if totalNeighbors == 0 {
-										return
-									}
-
-									// Calculate the distribution based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0       // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) +
-										ratio2*float64(len(g.neighbors2[i][j])) +
-										ratio3*float64(len(g.neighbors3[i][j]))
-
-									// Calculate virions for each neighbor group
-									virionsForNeighbors1 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate remaining virions
-									remainingVirions := virionsForLocalDiffusion - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// Distribute remaining virions based on ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-
-									// Calculate DIPs for each neighbor group (same logic)
-									dipsForNeighbors1 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									remainingDIPs := dipsForLocalDiffusion - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									for remainingDIPs > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDIPs--
-									}
-
-									// Distribute virions to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-								}
-
-							} else if par_celltocell_random == false {
-								//////////////////////////////
-								fmt.Println("parition particles jump celltocell and randomly is false")
-
-								if !allowVirionJump && !allowDIPJump {
-									fmt.Println("Virion and DIP jump are both disabled, NO JUMP")
-									// Calculate the total number of valid neighbors
-									totalNeighbors := 0
-
-									// Count valid neighbors from neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-
-									// If there are no valid neighbors, return early
-									if totalNeighbors == 0 {
-										return
-									}
-
-									// Calculate the distribution of virions and DIPs to each neighbor based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0 // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) + ratio2*float64(len(g.neighbors2[i][j])) + ratio3*float64(len(g.neighbors3[i][j]))
-									// if infected by virion or infected by both:
-									// Calculate the number of virions and DIPs assigned to each type of neighbor
-									virionsForNeighbors1 := int(math.Floor(float64(BURST_SIZE_V) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(BURST_SIZE_V) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(BURST_SIZE_V) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate the remaining virions and DIPs
-									remainingVirions := BURST_SIZE_V - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// // Randomly distribute the remaining virions based on the ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-									// if infected by vrion only or both:
-
-									totalVirionsAtCell := g.localVirions[i][j]
-									totalDIPsAtCell := g.localDips[i][j]
-
-									// Ensure we avoid division by zero
-									adjustedBurstSizeD := 0
-									if totalVirionsAtCell > 0 {
-										// Adjust BURST_SIZE_D based on the DIP-to-virion ratio at this cell
-										dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-										adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-									}
-
-									// Distribute DIPs to neighbors based on the adjusted BURST_SIZE_D
-									dipsForNeighbors1 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-									remainingDips := adjustedBurstSizeD - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									// Randomly distribute the remaining DIPs based on the ratio
-									for remainingDips > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDips--
-									}
-									// Distribute virions and DIPs to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-
-								} else { // "Jump" case for either virions, DIPs, or both
-									fmt.Println("Virion and DIP jump are allowed to JUMP")
-									if allowVirionJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-										if jumpRandomly {
-											for v := 0; v < BURST_SIZE_V; v++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump randomly to any location
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										} else {
-
-											totalVirionsAtCell := g.localVirions[i][j]
-											totalDIPsAtCell := g.localDips[i][j]
-											adjustedBurstSizeD := 0
-											if totalVirionsAtCell > 0 {
-												dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-												adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-											}
-
-											// Virion jump logic
-											virionTargets := make([]int, BURST_SIZE_V)
-											for v := 0; v < BURST_SIZE_V; v++ {
-												virionTargets[v] = rand.Intn(len(g.neighborsRingVirion[i][j]))
-											}
-
-											// Apply virion jumps
-											for _, targetIndex := range virionTargets {
-												spot := g.neighborsRingVirion[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													// fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump logic
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsRingDIP[i][j]))
-											}
-
-											// Apply DIP jumps
-											for _, targetIndex := range dipTargets {
-												spot := g.neighborsRingDIP[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													//fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										}
-									}
-
-									if allowDIPJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-
-										if jumpRandomly {
-											go func() {
-												for d := 0; d < adjustedBurstSizeD; d++ {
-													ni := rand.Intn(GRID_SIZE)
-													nj := rand.Intn(GRID_SIZE)
-													g.localDips[ni][nj]++
-												}
-											}()
-										} else {
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsRingDIP[i][j]))
-											}
-											go func() {
-												for _, targetIndex := range dipTargets {
-													spot := g.neighborsRingDIP[i][j][targetIndex]
-													ni, nj := spot[0], spot[1]
-													if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-														g.localDips[ni][nj]++
-													}
-												}
-											}()
-										}
-									}
-
-								}
-							}
+
+							newGrid[i][j] = DEAD
+							g.state[i][j] = DEAD
+							g.timeSinceDead[i][j] = 0
+							g.timeSinceInfectVorBoth[i][j] = -1
+							g.timeSinceInfectDIP[i][j] = -1
+							g.lysisThreshold[i][j] = -1
+
+							// Release virions and DIPs according to their spread settings
+							g.releaseBurst(i, j)
 						}
 					}
 					// update infected only by DIP or only by virions cells become "infected by both"
@@ -1649,23 +4255,23 @@ func (g *Grid) update(frameNum int) {
 							if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
 								// Calculate the infection probabilities
 
-								if R == 0 || TAU == 0 {
-									perParticleInfectionChance_V = RHO
+								if R == 0 || p.tau == 0 {
+									perParticleInfectionChance_V = p.rho
 								} else {
 									if VStimulateIFN == true { // R=1
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
+										perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
 									} else if VStimulateIFN == false { // usually only DIP stimulate IFN in this situlation
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell))
+										perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(globalIFNperCell))
 									}
 								}
 								var probabilityVInfection, probabilityDInfection float64
 
 								// Virion infection probability
-								probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
+								probabilityVInfection = g.virionInfectionProbability(i, j, perParticleInfectionChance_V)
 								infectedByVirion := rand.Float64() <= probabilityVInfection
 
 								// DIP infection probability
-								probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
+								probabilityDInfection = 1 - math.Pow(1-(p.rho*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
 								infectedByDip := rand.Float64() <= probabilityDInfection
 
 								// Determine the infection state based on virion and DIP infection
@@ -1676,21 +4282,23 @@ func (g *Grid) update(frameNum int) {
 								} else if infectedByDip {
 									newGrid[i][j] = INFECTED_DIP
 								}
+								if newGrid[i][j] != g.state[i][j] && g.excludesSuperinfection(i, j) {
+									newGrid[i][j] = g.state[i][j]
+								}
+								if newGrid[i][j] != g.state[i][j] {
+									g.takeUpParticles(i, j, infectedByVirion, infectedByDip)
+									g.seedGenomes(i, j, infectedByVirion, infectedByDip)
+								}
+								g.infectStrain(i, j, infectedByVirion, perParticleInfectionChance_V, newGrid[i][j] != g.state[i][j])
+								g.infectDIPVariant(i, j, infectedByDip, newGrid[i][j] != g.state[i][j])
 							}
 
 						}
 
 						if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
 
-							if g.timeSinceInfectVorBoth[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
-								adjusted_DIP_IFN_stimulate := 1.0
-								// if g.intraWT[i][j] > 0 {
-								// 	dvgWtRatio := float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
-								// 	if g.state[i][j] == INFECTED_BOTH {
-								// 		adjusted_DIP_IFN_stimulate *= dvgWtRatio * BOTH_IFN_stimulate_ratio
-								// 	}
-								// }
-								adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
+							if g.timeSinceInfectVorBoth[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && p.tau > 0 && len(ifnSpeciesList) == 0 {
+								adjusted_DIP_IFN_stimulate := g.genomeIFNStimulation(i, j, BOTH_IFN_stimulate_ratio)
 								var totalIncreaseAmount float64
 								if VStimulateIFN == true {
 
@@ -1708,9 +4316,9 @@ func (g *Grid) update(frameNum int) {
 									} else if g.state[i][j] == INFECTED_BOTH {
 										totalIncreaseAmount = (adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
 									}
-									fmt.Println("totalIncreaseAmount", totalIncreaseAmount)
 								}
 
+								totalIncreaseAmount *= g.ifnScale(i, j)
 								cellCount := len(g.neighborsIFNArea[i][j])
 
 								if cellCount > 0 {
@@ -1736,10 +4344,9 @@ func (g *Grid) update(frameNum int) {
 						if g.state[i][j] == INFECTED_DIP {
 							g.timeSinceInfectDIP[i][j] += TIMESTEP
 
-							if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
-								// adjusted_DIP_IFN_stimulate := float64(g.intraDVG[i][j]) * D_only_IFN_stimulate_ratio
-								adjusted_DIP_IFN_stimulate := D_only_IFN_stimulate_ratio
-								totalIncreaseAmount := adjusted_DIP_IFN_stimulate * float64(TIMESTEP)
+							if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && p.tau > 0 && len(ifnSpeciesList) == 0 {
+								adjusted_DIP_IFN_stimulate := g.genomeIFNStimulation(i, j, D_only_IFN_stimulate_ratio)
+								totalIncreaseAmount := adjusted_DIP_IFN_stimulate * float64(TIMESTEP) * g.ifnScale(i, j)
 
 								cellCount := len(g.neighborsIFNArea[i][j])
 								if cellCount > 0 {
@@ -1754,6 +4361,11 @@ func (g *Grid) update(frameNum int) {
 									}
 								}
 							}
+							g.applyDIPOnlyFate(i, j, &newGrid)
+						}
+
+						if len(ifnSpeciesList) > 0 {
+							g.produceIFNSpecies(i, j)
 						}
 
 					}
@@ -1761,11 +4373,18 @@ func (g *Grid) update(frameNum int) {
 				}
 			}
 		}
+		if len(ifnSpeciesList) > 0 {
+			g.syncIFNSpecies()
+		}
 		// Handle potentially regrowing dead cells
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
 				if g.state[i][j] == DEAD {
 					g.timeSinceDead[i][j] += TIMESTEP
+					if regrowthModel == "proliferation" {
+						g.proliferate(i, j, &newGrid)
+						continue
+					}
 
 					// Check if any neighboring cells are susceptible, allowing for regrowth
 					canRegrow := false
@@ -1791,7 +4410,7 @@ func (g *Grid) update(frameNum int) {
 					}
 
 					// If the conditions are met, the cell regrows
-					if canRegrow && g.timeSinceDead[i][j] >= int(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN) {
+					if canRegrow && g.readyToRegrow(i, j) {
 						newGrid[i][j] = REGROWTH
 						g.timeSinceRegrowth[i][j] = 0
 						g.timeSinceDead[i][j] = -1
@@ -1834,7 +4453,10 @@ func (g *Grid) update(frameNum int) {
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
 				g.stateChanged[i][j] = false
-				g.IFNConcentration[i][j] = globalIFN / float64(GRID_SIZE*GRID_SIZE)
+				if noCell[i][j] {
+					continue
+				}
+				g.IFNConcentration[i][j] = globalIFN / float64(len(realCells))
 			}
 		}
 		if globalIFN < 0 {
@@ -1850,13 +4472,16 @@ func (g *Grid) update(frameNum int) {
 		// Traverse the grid
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
+				p := g.profile(i, j)
 				// Only consider cells that are in the SUSCEPTIBLE or REGROWTH state
 
 				if g.state[i][j] == SUSCEPTIBLE || g.state[i][j] == REGROWTH || g.state[i][j] == INFECTED_DIP {
-					if g.IFNConcentration[i][j] > 0 && TAU > 0 {
+					if g.IFNConcentration[i][j]+g.exogenousIFN[i][j] > 0 && p.antiviralTAU > 0 {
 
 						if g.antiviralDuration[i][j] == -1 {
-							g.antiviralDuration[i][j] = int(math.Floor(rand.NormFloat64()*float64(TAU)/4 + float64(TAU)))
+							g.antiviralDuration[i][j] = antiviralDelay.sampleScaled(p.antiviralScale(), func() int {
+								return int(math.Floor(rand.NormFloat64()*float64(p.antiviralTAU)/4 + float64(p.antiviralTAU)))
+							})
 							g.timeSinceAntiviral[i][j] = 0
 						} else if g.timeSinceAntiviral[i][j] <= int(g.antiviralDuration[i][j]) {
 							g.timeSinceAntiviral[i][j] += TIMESTEP
@@ -1880,25 +4505,25 @@ func (g *Grid) update(frameNum int) {
 						if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
 							// Calculate the infection probabilities
 
-							if R == 0 || TAU == 0 {
-								perParticleInfectionChance_V = RHO
+							if R == 0 || p.tau == 0 {
+								perParticleInfectionChance_V = p.rho
 
 							} else {
 								if VStimulateIFN == true { // R=1
-									perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
+									perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
 								} else if VStimulateIFN == false { // usually only DIP stimulate IFN in this situlation
-									perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell))
+									perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(globalIFNperCell))
 								}
 							}
 
 							var probabilityVInfection, probabilityDInfection float64
 
 							// Virion infection probability
-							probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
+							probabilityVInfection = g.virionInfectionProbability(i, j, perParticleInfectionChance_V)
 							infectedByVirion := rand.Float64() <= probabilityVInfection
 
 							// DIP infection probability
-							probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
+							probabilityDInfection = 1 - math.Pow(1-(p.rho*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
 							infectedByDip := rand.Float64() <= probabilityDInfection
 
 							// Determine the infection state based on virion and DIP infection
@@ -1915,6 +4540,12 @@ func (g *Grid) update(frameNum int) {
 								g.timeSinceSusceptible[i][j] = -1
 								g.timeSinceRegrowth[i][j] = -1
 							}
+							if newGrid[i][j] != g.state[i][j] {
+								g.takeUpParticles(i, j, infectedByVirion, infectedByDip)
+								g.seedGenomes(i, j, infectedByVirion, infectedByDip)
+							}
+							g.infectStrain(i, j, infectedByVirion, perParticleInfectionChance_V, newGrid[i][j] != g.state[i][j])
+							g.infectDIPVariant(i, j, infectedByDip, newGrid[i][j] != g.state[i][j])
 						}
 
 						// Mark the state as changed if the cell is infected
@@ -1931,6 +4562,7 @@ func (g *Grid) update(frameNum int) {
 		// Process infected cells, no ifn wave, globally constant ifn
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
+				p := g.profile(i, j)
 				if par_celltocell_random == true {
 
 					allowRandomly := make([][]bool, GRID_SIZE)
@@ -1962,10 +4594,15 @@ func (g *Grid) update(frameNum int) {
 					if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH {
 
 						if g.lysisThreshold[i][j] == -1 {
-							g.lysisThreshold[i][j] = int(rand.NormFloat64()*STANDARD_LYSIS_TIME + MEAN_LYSIS_TIME)
+							lysis := g.lysisMean(i, j)
+							g.lysisThreshold[i][j] = lysisDelay.sampleScaled(lysis/MEAN_LYSIS_TIME, func() int {
+								return int(rand.NormFloat64()*lysis/4 + lysis)
+							})
 						}
 						g.timeSinceInfectVorBoth[i][j] += TIMESTEP
 						g.timeSinceInfectDIP[i][j] = -1
+						g.dipFateThreshold[i][j] = -1
+						g.releaseBudding(i, j)
 
 						// Check if the cell should lyse and release virions and DIPs
 						if g.timeSinceInfectVorBoth[i][j] > g.lysisThreshold[i][j] {
@@ -1983,368 +4620,8 @@ func (g *Grid) update(frameNum int) {
 							g.timeSinceInfectDIP[i][j] = -1
 							g.lysisThreshold[i][j] = -1
 
-							if par_celltocell_random == true {
-								// Calculate adjusted burst size for DIPs based on local ratio
-								totalVirionsAtCell := g.localVirions[i][j]
-								totalDIPsAtCell := g.localDips[i][j]
-								adjustedBurstSizeD := 0
-								if totalVirionsAtCell > 0 {
-									dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-									adjustedBurstSizeD = BURST_SIZE_D + int(float64(BURST_SIZE_D)*dipVirionRatio)
-								}
-								//  ---------------------------------------
-								// Partition mode: split particles between random jump and cell-to-cell
-
-								randomVirions := int(math.Floor(float64(BURST_SIZE_V) * k_JumpR))
-								virionsForLocalDiffusion := BURST_SIZE_V - randomVirions
-
-								randomDIPs := int(math.Floor(float64(adjustedBurstSizeD) * k_JumpR))
-								dipsForLocalDiffusion := adjustedBurstSizeD - randomDIPs
-
-								// Handle random jumps
-								for v := 0; v < randomVirions; v++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localVirions[ni][nj]++
-									g.totalRandomJumpVirions++
-								}
-								for d := 0; d < randomDIPs; d++ {
-									ni, nj := rand.Intn(GRID_SIZE), rand.Intn(GRID_SIZE)
-									g.localDips[ni][nj]++
-									g.totalRandomJumpDIPs++
-								}
-
-								// Handle local diffusion
-								// Handle local diffusion with localVirions & localDIPs (keep original logic unchanged)
-								if virionsForLocalDiffusion > 0 || dipsForLocalDiffusion > 0 {
-									// Calculate the total number of valid neighbors
-									totalNeighbors := 0
-
-									// Count valid neighbors from neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-
-									if totalNeighbors == 0 {
-										return
-									}
-
-									// Calculate the distribution based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0       // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) +
-										ratio2*float64(len(g.neighbors2[i][j])) +
-										ratio3*float64(len(g.neighbors3[i][j]))
-
-									// Calculate virions for each neighbor group
-									virionsForNeighbors1 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(virionsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate remaining virions
-									remainingVirions := virionsForLocalDiffusion - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// Distribute remaining virions based on ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-
-									// Calculate DIPs for each neighbor group (same logic)
-									dipsForNeighbors1 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(dipsForLocalDiffusion) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									remainingDIPs := dipsForLocalDiffusion - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									for remainingDIPs > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDIPs--
-									}
-									// Distribute virions to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-								}
-
-							} else if par_celltocell_random == false {
-								if !allowVirionJump && !allowDIPJump {
-									// Calculate the total number of valid neighbors
-									totalNeighbors := 0
-
-									// Count valid neighbors from neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-									// Count valid neighbors from neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										if dir != [2]int{-1, -1} {
-											totalNeighbors++
-										}
-									}
-
-									// If there are no valid neighbors, return early
-									if totalNeighbors == 0 {
-										return
-									}
-
-									// Calculate the distribution of virions and DIPs to each neighbor based on the ratio √3 : 2√3 : 3
-									sqrt3 := math.Sqrt(3)
-									ratio1 := 1.0               // sqrt3     // Weight for neighbors1
-									ratio2 := 1.0 / 2           // 2 * sqrt3 // Weight for neighbors2
-									ratio3 := 1.0 / (3 / sqrt3) // 3.0 // Weight for neighbors3
-									totalRatio := ratio1*float64(len(g.neighbors1[i][j])) + ratio2*float64(len(g.neighbors2[i][j])) + ratio3*float64(len(g.neighbors3[i][j]))
-
-									// if infected by virion or infected by both:
-									// Calculate the number of virions and DIPs assigned to each type of neighbor
-									virionsForNeighbors1 := int(math.Floor(float64(BURST_SIZE_V) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									virionsForNeighbors2 := int(math.Floor(float64(BURST_SIZE_V) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									virionsForNeighbors3 := int(math.Floor(float64(BURST_SIZE_V) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-
-									// Calculate the remaining virions and DIPs
-									remainingVirions := BURST_SIZE_V - (virionsForNeighbors1 + virionsForNeighbors2 + virionsForNeighbors3)
-
-									// // Randomly distribute the remaining virions based on the ratio
-									for remainingVirions > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											virionsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											virionsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											virionsForNeighbors3++
-										}
-										remainingVirions--
-									}
-									// if infected by vrion only or both:
-
-									totalVirionsAtCell := g.localVirions[i][j]
-									totalDIPsAtCell := g.localDips[i][j]
-
-									// Ensure we avoid division by zero
-									adjustedBurstSizeD := 0
-									if totalVirionsAtCell > 0 {
-										// Adjust BURST_SIZE_D based on the DIP-to-virion ratio at this cell
-										dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-										adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-									}
-
-									// Distribute DIPs to neighbors based on the adjusted BURST_SIZE_D
-									dipsForNeighbors1 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio1 * float64(len(g.neighbors1[i][j]))) / totalRatio))
-									dipsForNeighbors2 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio2 * float64(len(g.neighbors2[i][j]))) / totalRatio))
-									dipsForNeighbors3 := int(math.Floor(float64(adjustedBurstSizeD) * (ratio3 * float64(len(g.neighbors3[i][j]))) / totalRatio))
-									remainingDips := adjustedBurstSizeD - (dipsForNeighbors1 + dipsForNeighbors2 + dipsForNeighbors3)
-
-									// Randomly distribute the remaining DIPs based on the ratio
-									for remainingDips > 0 {
-										randVal := rand.Float64() * totalRatio
-										if randVal < ratio1 && len(g.neighbors1[i][j]) > 0 {
-											dipsForNeighbors1++
-										} else if randVal < (ratio1+ratio2) && len(g.neighbors2[i][j]) > 0 {
-											dipsForNeighbors2++
-										} else if len(g.neighbors3[i][j]) > 0 {
-											dipsForNeighbors3++
-										}
-										remainingDips--
-									}
-									// Distribute virions and DIPs to neighbors1
-									for _, dir := range g.neighbors1[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											if g.state[ni][nj] == SUSCEPTIBLE {
-												g.localVirions[ni][nj] += virionsForNeighbors1 / len(g.neighbors1[i][j])
-												g.localDips[ni][nj] += dipsForNeighbors1 / len(g.neighbors1[i][j])
-											}
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors2
-									for _, dir := range g.neighbors2[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors2 / len(g.neighbors2[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors2 / len(g.neighbors2[i][j])
-										}
-									}
-
-									// Distribute virions and DIPs to neighbors3
-									for _, dir := range g.neighbors3[i][j] {
-										ni, nj := dir[0], dir[1]
-										if dir != [2]int{-1, -1} && ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-											g.localVirions[ni][nj] += virionsForNeighbors3 / len(g.neighbors3[i][j])
-											g.localDips[ni][nj] += dipsForNeighbors3 / len(g.neighbors3[i][j])
-										}
-									}
-
-								} else { // "Jump" case for either virions, DIPs, or both
-
-									if allowVirionJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-
-										if jumpRandomly {
-											for v := 0; v < BURST_SIZE_V; v++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump randomly to any location
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												ni := rand.Intn(GRID_SIZE) // Randomly select a row
-												nj := rand.Intn(GRID_SIZE) // Randomly select a column
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										} else {
-											// Virion jump logic
-											virionTargets := make([]int, BURST_SIZE_V)
-											for v := 0; v < BURST_SIZE_V; v++ {
-												virionTargets[v] = rand.Intn(len(g.neighborsRingVirion[i][j]))
-											}
-
-											// Apply virion jumps
-											for _, targetIndex := range virionTargets {
-												spot := g.neighborsRingVirion[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													// fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the virion jump
-												g.localVirions[ni][nj]++
-											}
-
-											// DIP jump logic
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsRingDIP[i][j]))
-											}
-
-											// Apply DIP jumps
-											for _, targetIndex := range dipTargets {
-												spot := g.neighborsRingDIP[i][j][targetIndex]
-												ni, nj := spot[0], spot[1]
-
-												// Ensure the jump target is valid
-												if ni < 0 || ni >= GRID_SIZE || nj < 0 || nj >= GRID_SIZE {
-													//fmt.Printf("Skipping invalid jump target (%d, %d) from (%d, %d)\n", ni, nj, i, j)
-													continue
-												}
-
-												// Apply the DIP jump
-												g.localDips[ni][nj]++
-											}
-										}
-									}
-
-									if allowDIPJump {
-										totalVirionsAtCell := g.localVirions[i][j]
-										totalDIPsAtCell := g.localDips[i][j]
-										adjustedBurstSizeD := 0
-										if totalVirionsAtCell > 0 {
-											dipVirionRatio := float64(totalDIPsAtCell) / float64(totalVirionsAtCell)
-											adjustedBurstSizeD = BURST_SIZE_D + int(math.Floor(float64(BURST_SIZE_D)*dipVirionRatio))
-										}
-
-										if jumpRandomly {
-											go func() {
-												for d := 0; d < adjustedBurstSizeD; d++ {
-													ni := rand.Intn(GRID_SIZE)
-													nj := rand.Intn(GRID_SIZE)
-													g.localDips[ni][nj]++
-												}
-											}()
-										} else {
-											dipTargets := make([]int, adjustedBurstSizeD)
-											for d := 0; d < adjustedBurstSizeD; d++ {
-												dipTargets[d] = rand.Intn(len(g.neighborsRingDIP[i][j]))
-											}
-											go func() {
-												for _, targetIndex := range dipTargets {
-													spot := g.neighborsRingDIP[i][j][targetIndex]
-													ni, nj := spot[0], spot[1]
-													if ni >= 0 && ni < GRID_SIZE && nj >= 0 && nj < GRID_SIZE {
-														g.localDips[ni][nj]++
-													}
-												}
-											}()
-										}
-									}
-								}
-							}
+							// Release virions and DIPs according to their spread settings
+							g.releaseBurst(i, j)
 						}
 					}
 					// update infected only by DIP or only by virions cells become infected by both
@@ -2356,23 +4633,23 @@ func (g *Grid) update(frameNum int) {
 							if g.localVirions[i][j] > 0 || g.localDips[i][j] > 0 {
 								// Calculate the infection probabilities
 
-								if R == 0 || TAU == 0 {
-									perParticleInfectionChance_V = RHO
+								if R == 0 || p.tau == 0 {
+									perParticleInfectionChance_V = p.rho
 								} else {
 									if VStimulateIFN == true { // R=1
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
+										perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(globalIFNperCell/float64(R)))
 									} else if VStimulateIFN == false { // usually only DIP stimulate IFN in this situlation
-										perParticleInfectionChance_V = RHO * math.Exp(-ALPHA*(globalIFNperCell))
+										perParticleInfectionChance_V = p.rho * math.Exp(-ALPHA*(globalIFNperCell))
 									}
 								}
 								var probabilityVInfection, probabilityDInfection float64
 
 								// Virion infection probability
-								probabilityVInfection = 1 - math.Pow(1-perParticleInfectionChance_V, float64(g.localVirions[i][j]))
+								probabilityVInfection = g.virionInfectionProbability(i, j, perParticleInfectionChance_V)
 								infectedByVirion := rand.Float64() <= probabilityVInfection
 
 								// DIP infection probability
-								probabilityDInfection = 1 - math.Pow(1-(RHO*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
+								probabilityDInfection = 1 - math.Pow(1-(p.rho*math.Exp(-ALPHA*(globalIFNperCell))), float64(g.localDips[i][j]))
 								infectedByDip := rand.Float64() <= probabilityDInfection
 
 								// Determine the infection state based on virion and DIP infection
@@ -2383,41 +4660,37 @@ func (g *Grid) update(frameNum int) {
 								} else if infectedByDip {
 									newGrid[i][j] = INFECTED_DIP
 								}
+								if newGrid[i][j] != g.state[i][j] && g.excludesSuperinfection(i, j) {
+									newGrid[i][j] = g.state[i][j]
+								}
+								if newGrid[i][j] != g.state[i][j] {
+									g.takeUpParticles(i, j, infectedByVirion, infectedByDip)
+									g.seedGenomes(i, j, infectedByVirion, infectedByDip)
+								}
+								g.infectStrain(i, j, infectedByVirion, perParticleInfectionChance_V, newGrid[i][j] != g.state[i][j])
+								g.infectDIPVariant(i, j, infectedByDip, newGrid[i][j] != g.state[i][j])
 							}
 
 						}
-						if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH && TAU > 0 {
+						if g.state[i][j] == INFECTED_VIRION || g.state[i][j] == INFECTED_BOTH && p.tau > 0 {
 
 							if VStimulateIFN == true {
 								if g.state[i][j] == INFECTED_VIRION {
-									g.IFNConcentration[i][j] += float64(R) * float64(TIMESTEP) * ifnBothFold
+									g.IFNConcentration[i][j] += float64(R) * float64(TIMESTEP) * ifnBothFold * g.ifnScale(i, j)
 								} else if g.state[i][j] == INFECTED_BOTH {
 
-									// if g.intraWT[i][j] > 0 {
-									// 	dvgWtRatio := float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
-									// 	if g.state[i][j] == INFECTED_BOTH {
-									// 		adjusted_DIP_IFN_stimulate *= dvgWtRatio * BOTH_IFN_stimulate_ratio
-									// 	}
-									// }
-									adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
-									g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
+									adjusted_DIP_IFN_stimulate = g.genomeIFNStimulation(i, j, BOTH_IFN_stimulate_ratio)
+									g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP) * g.ifnScale(i, j)
 								}
 							} else if VStimulateIFN == false {
 								if g.state[i][j] == INFECTED_VIRION {
 									// do nothing since virions do not stimulate IFN
 								} else if g.state[i][j] == INFECTED_BOTH {
 
-									// if g.intraWT[i][j] > 0 {
-									// 	dvgWtRatio := float64(g.intraDVG[i][j]) / float64(g.intraWT[i][j])
-									// 	if g.state[i][j] == INFECTED_BOTH {
-									// 		adjusted_DIP_IFN_stimulate *= dvgWtRatio * BOTH_IFN_stimulate_ratio
-									// 	}
-									// }
-
-									adjusted_DIP_IFN_stimulate = BOTH_IFN_stimulate_ratio
+									adjusted_DIP_IFN_stimulate = g.genomeIFNStimulation(i, j, BOTH_IFN_stimulate_ratio)
 
 								}
-								g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
+								g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP) * g.ifnScale(i, j)
 							}
 
 							globalIFN += g.IFNConcentration[i][j]
@@ -2428,14 +4701,13 @@ func (g *Grid) update(frameNum int) {
 
 							g.timeSinceInfectDIP[i][j] += TIMESTEP
 
-							if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && TAU > 0 {
+							if g.timeSinceInfectDIP[i][j] > IFN_DELAY+int(math.Floor(rand.NormFloat64()*float64(STD_IFN_DELAY))) && p.tau > 0 {
 
-								//adjusted_DIP_IFN_stimulate := float64(g.intraDVG[i][j]) * D_only_IFN_stimulate_ratio
-								adjusted_DIP_IFN_stimulate := D_only_IFN_stimulate_ratio
-								g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP)
+								adjusted_DIP_IFN_stimulate := g.genomeIFNStimulation(i, j, D_only_IFN_stimulate_ratio)
+								g.IFNConcentration[i][j] += (float64(R) + adjusted_DIP_IFN_stimulate) * float64(TIMESTEP) * g.ifnScale(i, j)
 								globalIFN += g.IFNConcentration[i][j]
 							}
-
+							g.applyDIPOnlyFate(i, j, &newGrid)
 						}
 
 					}
@@ -2448,6 +4720,10 @@ func (g *Grid) update(frameNum int) {
 			for j := 0; j < GRID_SIZE; j++ {
 				if g.state[i][j] == DEAD {
 					g.timeSinceDead[i][j] += TIMESTEP
+					if regrowthModel == "proliferation" {
+						g.proliferate(i, j, &newGrid)
+						continue
+					}
 
 					// Check if any neighboring cells are susceptible, allowing for regrowth
 					canRegrow := false
@@ -2470,7 +4746,7 @@ func (g *Grid) update(frameNum int) {
 					}
 
 					// If the conditions are met, the cell regrows
-					if canRegrow && g.timeSinceDead[i][j] >= int(rand.NormFloat64()*REGROWTH_STD+REGROWTH_MEAN) {
+					if canRegrow && g.readyToRegrow(i, j) {
 						newGrid[i][j] = REGROWTH
 						g.timeSinceRegrowth[i][j] = 0
 						g.timeSinceDead[i][j] = -1
@@ -2489,7 +4765,7 @@ func (g *Grid) update(frameNum int) {
 			}
 		}
 
-		globalIFNperCell = globalIFN / float64(GRID_SIZE*GRID_SIZE)
+		globalIFNperCell = globalIFN / float64(len(realCells))
 		// Apply the updated grid state
 		g.state = newGrid
 
@@ -2521,21 +4797,37 @@ func (g *Grid) update(frameNum int) {
 	}
 
 	// TIMESTEP = 1 hour. If 1 hour/step, use dt = 1.0
+	g.decayExogenousIFN()
 
 	if virion_half_life != 0 {
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
 				// Update virus count using half-life formula
 				factorV := math.Pow(0.5, float64(TIMESTEP)/virion_half_life)
-				g.localVirions[i][j] = int(math.Floor(float64(g.localVirions[i][j])*factorV + 0.5))
+				before := g.localVirions[i][j]
+				if len(strains) > 0 {
+					g.decayStrainVirions(i, j, factorV)
+				} else {
+					g.localVirions[i][j] = int(math.Floor(float64(g.localVirions[i][j])*factorV + 0.5))
+				}
+				g.virionLedger.decayed += before - g.localVirions[i][j]
 
 				if dip_half_life != 0 {
 					factorD := math.Pow(0.5, float64(TIMESTEP)/dip_half_life)
-					g.localDips[i][j] = int(math.Floor(float64(g.localDips[i][j])*factorD + 0.5))
+					before := g.localDips[i][j]
+					if len(dipVariants) > 0 {
+						g.decayDIPVariants(i, j, factorD)
+					} else {
+						g.localDips[i][j] = int(math.Floor(float64(g.localDips[i][j])*factorD + 0.5))
+					}
+					g.dipLedger.decayed += before - g.localDips[i][j]
 				}
 			}
 		}
 	}
+	if debugMode {
+		g.checkLedger(frameNum)
+	}
 
 }
 
@@ -2562,7 +4854,7 @@ func (g *Grid) recordSimulationData(writer *csv.Writer, frameNum int) {
 		strconv.FormatFloat(virion_half_life, 'f', 6, 64), // Add virion clearance rate
 		strconv.FormatFloat(dip_half_life, 'f', 6, 64),    // Add DIP clearance rate
 		strconv.FormatFloat(ifn_half_life, 'f', 6, 64),    // Add IFN clearance rate
-		strconv.FormatFloat(globalIFN/float64(GRID_SIZE*GRID_SIZE), 'f', 6, 64),
+		strconv.FormatFloat(globalIFN/float64(len(realCells)), 'f', 6, 64),
 		strconv.Itoa(totalVirions),
 		strconv.Itoa(totalDIPs),
 		deadCellPercentage,
@@ -2630,6 +4922,44 @@ func (g *Grid) recordSimulationData(writer *csv.Writer, frameNum int) {
 		strconv.Itoa(g.totalRandomJumpDIPs),           // New: total number of randomly jumping DIPs
 		strconv.FormatFloat(dipAdvantage, 'f', 6, 64), // DIP advantage = burstSizeD / burstSizeV
 	}
+	row = append(row, strconv.FormatFloat(g.totalExogenousIFN()/float64(len(realCells)), 'f', 6, 64))
+	row = append(row, boundaryCondition, strconv.Itoa(g.virionLedger.lostOffGrid), strconv.Itoa(g.dipLedger.lostOffGrid))
+	row = append(row, strconv.Itoa(len(realCells)), *flag_virionKernel, *flag_dipKernel)
+	row = append(row, virionSpread.mode, dipSpread.mode,
+		strconv.FormatFloat(virionSpread.kJumpR, 'f', 6, 64), strconv.FormatFloat(dipSpread.kJumpR, 'f', 6, 64))
+	row = append(row, depositionPolicy, particleUptake, strconv.FormatBool(legacyDIPBurst))
+	meanWT, meanDVG := g.meanGenomes()
+	row = append(row, strconv.FormatBool(intracellularModel), strconv.FormatFloat(meanWT, 'f', 6, 64), strconv.FormatFloat(meanDVG, 'f', 6, 64))
+	row = append(row, releaseMode, strconv.FormatFloat(buddingRate, 'f', 6, 64), strconv.Itoa(eclipsePeriod))
+	row = append(row, dipOnlyFate, strconv.Itoa(g.dipOnlyDeaths), strconv.Itoa(g.dipOnlyRecoveries))
+	row = append(row, strconv.Itoa(superinfectionExclusion), strconv.Itoa(g.excludedCells))
+	row = append(row, regrowthModel, strconv.FormatFloat(proliferationRate, 'f', 6, 64), regrowthInheritance)
+	row = append(row, *flag_dipVariants, strconv.FormatFloat(dipDeNovoRate, 'f', 6, 64), strconv.Itoa(len(dipVariants)),
+		strconv.Itoa(g.recordDIPVariants(dipVariantWriter, frameNum)))
+	row = append(row, strconv.FormatFloat(drugRhoFactor, 'f', 6, 64), strconv.FormatFloat(drugBurstFactor, 'f', 6, 64))
+	for _, l := range []particleLedger{g.virionLedger, g.dipLedger} {
+		for _, v := range []int{l.produced, l.deposited, l.decayed, l.lostRounding, l.lostBlocked, l.consumed, l.washed} {
+			row = append(row, strconv.Itoa(v))
+		}
+	}
+	for k := range ifnSpeciesList {
+		total := g.totalIFNSpecies(k)
+		row = append(row,
+			strconv.FormatFloat(total, 'f', 6, 64),
+			strconv.FormatFloat(total/float64(len(realCells)), 'f', 6, 64),
+		)
+	}
+	strainVirions, strainInfected := g.strainCounts()
+	for k := range strains {
+		row = append(row, strconv.Itoa(strainVirions[k]), strconv.Itoa(strainInfected[k]))
+	}
+	if len(cellProfiles) > 1 {
+		for _, byState := range g.cellTypeCounts() {
+			for _, v := range byState {
+				row = append(row, strconv.Itoa(v))
+			}
+		}
+	}
 
 	writer.Write(row)
 	writer.Flush()
@@ -2641,49 +4971,35 @@ func (g *Grid) gridToImage(videotype string) *image.RGBA {
 	imgWidth := GRID_SIZE * CELL_SIZE * 2                       // Calculate the image width
 	imgHeight := GRID_SIZE * CELL_SIZE * 2                      // Calculate the image height
 	img := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight)) // Create a new image
-	if videotype == "states" {
-		// Define colors for different states
-		colors := map[int]color.Color{
-			SUSCEPTIBLE:     color.RGBA{0, 0, 0, 255},       // Susceptible state: black
-			INFECTED_VIRION: color.RGBA{255, 0, 0, 255},     // Infected by virion: red
-			INFECTED_DIP:    color.RGBA{0, 255, 0, 255},     // Infected by DIP: green
-			INFECTED_BOTH:   color.RGBA{255, 255, 0, 255},   // Infected by both: yellow
-			DEAD:            color.RGBA{169, 169, 169, 255}, // Dead state: gray
-			ANTIVIRAL:       color.RGBA{0, 0, 255, 255},     // Antiviral state: blue
-			REGROWTH:        color.RGBA{128, 0, 128, 255},   // Regrowth state: purple
-		}
+	if videotype == "states" || videotype == "strains" {
 		fillBackground(img, color.RGBA{0, 0, 0, 255})
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
-				x, y := calculateHexCenter(i, j)              // Calculate the center of each hexagon
-				drawHexagon(img, x, y, colors[g.state[i][j]]) // Draw the hexagon based on the cell state
+				x, y := calculateHexCenter(i, j) // Calculate the center of each hexagon
+				var c color.Color = stateColors[g.state[i][j]]
+				if in := g.strainsOf(i, j); videotype == "strains" && len(in) > 0 {
+					// Virion-infected cells take their strain's colour, mixed infections are white
+					c = strains[in[0]].color
+					if len(in) > 1 {
+						c = color.RGBA{255, 255, 255, 255}
+					}
+				}
+				drawHexagon(img, x, y, c) // Draw the hexagon based on the cell state
 			}
 		}
 		// Return the image
 	} else if videotype == "IFNconcentration" { // IFN concentration visualization
-		black := color.RGBA{0, 0, 0, 255} // Default color (black)
-
 		for i := 0; i < GRID_SIZE; i++ {
 			for j := 0; j < GRID_SIZE; j++ {
 				x, y := calculateHexCenter(i, j) // Calculate hexagon center coordinates
-				ifnValue := g.IFNConcentration[i][j]
-
-				var cellColor color.RGBA
-				if ifnValue <= 0 {
-					cellColor = black // IFN ≤ 0, black
-				} else if ifnValue > 0 && ifnValue <= 1 {
-					cellColor = color.RGBA{0, 0, 255, 255} // Blue
-				} else if ifnValue > 1 && ifnValue <= 2 {
-					cellColor = color.RGBA{0, 255, 0, 255} // Green
-				} else if ifnValue > 2 && ifnValue <= 5 {
-					cellColor = color.RGBA{255, 255, 0, 255} // Yellow
-				} else if ifnValue > 5 && ifnValue <= 10 {
-					cellColor = color.RGBA{255, 165, 0, 255} // Orange
-				} else {
-					cellColor = color.RGBA{255, 0, 0, 255} // Red
-				}
-
-				drawHexagon(img, x, y, cellColor)
+				drawHexagon(img, x, y, ifnColor(g.IFNConcentration[i][j]))
+			}
+		}
+	} else if k := ifnSpeciesIndex(strings.TrimPrefix(videotype, "IFN_")); strings.HasPrefix(videotype, "IFN_") && k >= 0 { // Single IFN species
+		for i := 0; i < GRID_SIZE; i++ {
+			for j := 0; j < GRID_SIZE; j++ {
+				x, y := calculateHexCenter(i, j)
+				drawHexagon(img, x, y, ifnColor(g.ifnSpeciesConc[k][i][j]))
 			}
 		}
 	} else if videotype == "IFNonlyLargerThanZero" { // IFN concentration visualization
@@ -2776,6 +5092,22 @@ func (g *Grid) gridToImage(videotype string) *image.RGBA {
 	return img // Return the image
 }
 
+// Color scale for IFN concentration
+func ifnColor(ifnValue float64) color.RGBA {
+	if ifnValue <= 0 {
+		return color.RGBA{0, 0, 0, 255} // IFN ≤ 0, black
+	} else if ifnValue <= 1 {
+		return color.RGBA{0, 0, 255, 255} // Blue
+	} else if ifnValue <= 2 {
+		return color.RGBA{0, 255, 0, 255} // Green
+	} else if ifnValue <= 5 {
+		return color.RGBA{255, 255, 0, 255} // Yellow
+	} else if ifnValue <= 10 {
+		return color.RGBA{255, 165, 0, 255} // Orange
+	}
+	return color.RGBA{255, 0, 0, 255} // Red
+}
+
 func drawTextWithBackground(img *image.RGBA, x, y int, label string, textColor, borderColor, bgColor color.Color) {
 	face := basicfont.Face7x13
 	textWidth := len(label) * 7
@@ -2819,14 +5151,26 @@ func addStaticLegend(img *image.RGBA, startX, startY int) {
 		"By both", "By DIP", "By Virion",
 		"Antiviral", "Uninfected", "Plaque", "Regrowth",
 	}
+	if len(realCells) < GRID_SIZE*GRID_SIZE {
+		legendItems = append(legendItems, "Outside well")
+	}
 	legendColors := map[string]color.Color{
-		"By both":    color.RGBA{255, 200, 0, 255},
-		"By DIP":     color.RGBA{0, 255, 0, 255},
-		"By Virion":  color.RGBA{255, 0, 0, 255},
-		"Antiviral":  color.RGBA{0, 102, 255, 255},
-		"Uninfected": color.RGBA{0, 0, 0, 255},
-		"Plaque":     color.RGBA{84, 110, 122, 255},
-		"Regrowth":   color.RGBA{128, 0, 128, 255},
+		"By both":      color.RGBA{255, 200, 0, 255},
+		"By DIP":       color.RGBA{0, 255, 0, 255},
+		"By Virion":    color.RGBA{255, 0, 0, 255},
+		"Antiviral":    color.RGBA{0, 102, 255, 255},
+		"Uninfected":   color.RGBA{0, 0, 0, 255},
+		"Plaque":       color.RGBA{84, 110, 122, 255},
+		"Regrowth":     color.RGBA{128, 0, 128, 255},
+		"Outside well": color.RGBA{235, 235, 235, 255},
+	}
+	if videotype == "strains" {
+		for _, st := range strains {
+			legendItems = append(legendItems, st.name)
+			legendColors[st.name] = st.color
+		}
+		legendItems = append(legendItems, "Mixed strains")
+		legendColors["Mixed strains"] = color.RGBA{255, 255, 255, 255}
 	}
 
 	// Calculate background box size (keep original logic)
@@ -2894,9 +5238,8 @@ func (g *Grid) gridToImageWithGraph(frameNum int, virionOnly, dipOnly, both []fl
 
 // Calculate the center of each hexagonal cell
 func calculateHexCenter(i, j int) (int, int) {
-	x := i * CELL_SIZE * 3 / 2                                                          // Calculate the x-coordinate
-	y := int(float64(j)*CELL_SIZE*math.Sqrt(3) + float64(i%2)*CELL_SIZE*math.Sqrt(3)/2) // Calculate the y-coordinate
-	return x, y                                                                         // Return the center coordinates
+	x, y := hexToPixel(i, j) // Same lattice as the simulation neighbourhoods
+	return int(x), int(y)    // Return the center coordinates
 }
 
 func drawHexagon(img *image.RGBA, x, y int, c color.Color) {
@@ -2946,8 +5289,328 @@ func isPointInHexagon(p image.Point, hex [6]image.Point) bool {
 	return true // Return true if the point is inside the hexagon
 }
 
+// runPassages runs the passage command: a serial passage of -passages plates. Each plate
+// is a run up to -harvestTime in its own folder; the extracellular virions and DIPs at
+// -harvestTime are divided by -dilution and seed the next plate as -v_pfu_initial and
+// -d_pfu_initial, through the usual -option. passage_summary.csv lists the titres and
+// DIP:virion ratio of every passage. All simulation flags are accepted and passed on.
+func runPassages(args []string) {
+	fs := flag.NewFlagSet("passage", flag.ExitOnError)
+	passages := fs.Int("passages", 5, "Number of passages")
+	harvestTime := fs.Int("harvestTime", 48, "Time step at which the extracellular virions and DIPs are harvested")
+	dilution := fs.Float64("dilution", 100, "Dilution factor between the harvest and the next plate's inoculum")
+	flag.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	fs.Parse(args)
+	loadConfig(fs)
+	if *passages < 1 || *harvestTime < 0 || *harvestTime >= TIME_STEPS || *dilution < 1 {
+		log.Fatalf("passage needs -passages >= 1, 0 <= -harvestTime < %d and -dilution >= 1", TIME_STEPS)
+	}
+	var simArgs []string
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "passages", "harvestTime", "dilution", "v_pfu_initial", "d_pfu_initial", "endTime":
+			return
+		}
+		simArgs = append(simArgs, forwardFlag(f))
+	})
+	// Nothing after the harvest is used, so each plate stops there
+	simArgs = append(simArgs, "-endTime="+strconv.Itoa(*harvestTime))
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate the simulator: %v", err)
+	}
+
+	root := fmt.Sprintf("%d_passage_P%d_dil%s_harvest%d", getNextFolderNumber("./"), *passages,
+		strconv.FormatFloat(*dilution, 'f', -1, 64), *harvestTime)
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		log.Fatalf("Failed to create folder: %v", err)
+	}
+	file, err := os.Create(filepath.Join(root, "passage_summary.csv"))
+	if err != nil {
+		log.Fatalf("Failed to create passage summary: %v", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	writer.Write([]string{"passage", "inoculumVirions", "inoculumDIPs", "harvestTime", "harvestVirions", "harvestDIPs", "DIPtoVirionRatio", "dilution", "runFolder"})
+
+	v, d := *flag_v_pfu_initial, *flag_d_pfu_initial
+	for n := 1; n <= *passages; n++ {
+		dir := filepath.Join(root, fmt.Sprintf("passage_%02d", n))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			log.Fatalf("Failed to create folder: %v", err)
+		}
+		logFile, err := os.Create(filepath.Join(dir, "run.log"))
+		if err != nil {
+			log.Fatalf("Failed to create run log: %v", err)
+		}
+		runArgs := append(simArgs,
+			"-v_pfu_initial="+strconv.FormatFloat(v, 'f', -1, 64),
+			"-d_pfu_initial="+strconv.FormatFloat(d, 'f', -1, 64))
+		if n > 1 {
+			// Later plates are seeded from the harvest, not the first plate's initial condition
+			runArgs = append(runArgs, "-initialCondition=", "-initialState=")
+		}
+		cmd := exec.Command(exe, runArgs...)
+		cmd.Dir, cmd.Stdout, cmd.Stderr = dir, logFile, logFile
+		fmt.Printf("Passage %d: inoculum %.2f virions, %.2f DIPs\n", n, v, d)
+		err = cmd.Run()
+		logFile.Close()
+		if err != nil {
+			log.Fatalf("Passage %d failed (see %s): %v", n, filepath.Join(dir, "run.log"), err)
+		}
+
+		runFolder, harvestV, harvestD := readHarvest(dir, *harvestTime)
+		ratio := math.Inf(1)
+		if harvestV > 0 {
+			ratio = float64(harvestD) / float64(harvestV)
+		} else if harvestD == 0 {
+			ratio = math.NaN()
+		}
+		writer.Write([]string{
+			strconv.Itoa(n),
+			strconv.FormatFloat(v, 'f', -1, 64), strconv.FormatFloat(d, 'f', -1, 64),
+			strconv.Itoa(*harvestTime), strconv.Itoa(harvestV), strconv.Itoa(harvestD),
+			strconv.FormatFloat(ratio, 'f', 6, 64), strconv.FormatFloat(*dilution, 'f', -1, 64),
+			filepath.Join(filepath.Base(dir), runFolder),
+		})
+		writer.Flush()
+		fmt.Printf("Passage %d: harvested %d virions, %d DIPs at t=%d (DIP:virion %.4f)\n", n, harvestV, harvestD, *harvestTime, ratio)
+
+		v, d = float64(harvestV) / *dilution, float64(harvestD) / *dilution
+		if math.Round(v) == 0 && math.Round(d) == 0 && n < *passages {
+			fmt.Printf("Passage %d: the diluted harvest holds no particles; stopping\n", n)
+			break
+		}
+	}
+	log.Printf("Passage summary saved in %s\n", filepath.Join(root, "passage_summary.csv"))
+}
+
+// forwardFlag formats a flag for a run started in another folder; values naming an
+// existing file (-config, -initialState, a PNG -wellMask or -cellTypeLayout) are made
+// absolute so they still resolve there
+func forwardFlag(f *flag.Flag) string {
+	value := f.Value.String()
+	if value != "" {
+		if _, err := os.Stat(value); err == nil {
+			if abs, err := filepath.Abs(value); err == nil {
+				value = abs
+			}
+		}
+	}
+	return "-" + f.Name + "=" + value
+}
+
+// readHarvest returns the run folder a passage wrote in dir and the extracellular
+// virions and DIPs its simulation_output.csv records at the harvest time
+func readHarvest(dir string, harvestTime int) (string, int, int) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*", "simulation_output.csv"))
+	if err != nil || len(matches) != 1 {
+		log.Fatalf("Expected one simulation_output.csv in %s, found %d", dir, len(matches))
+	}
+	file, err := os.Open(matches[0])
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", matches[0], err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(records) < 2 {
+		log.Fatalf("Failed to read %s: %v", matches[0], err)
+	}
+	column := map[string]int{}
+	for k, name := range records[0] {
+		column[name] = k
+	}
+	for _, row := range records[1:] {
+		if row[column["Time"]] != strconv.Itoa(harvestTime) {
+			continue
+		}
+		v, errV := strconv.Atoi(row[column["Total Extracellular Virions"]])
+		d, errD := strconv.Atoi(row[column["Total Extracellular DIPs"]])
+		if errV != nil || errD != nil {
+			log.Fatalf("Invalid particle totals at t=%d in %s", harvestTime, matches[0])
+		}
+		return filepath.Base(filepath.Dir(matches[0])), v, d
+	}
+	log.Fatalf("No row for t=%d in %s", harvestTime, matches[0])
+	return "", 0, 0
+}
+
+// runTitration runs the titrate command: a plaque assay of a stock of -stock particles.
+// The stock is diluted -dilutionFactor fold -dilutionSteps times; each dilution seeds
+// -replicates wells with a Poisson draw of stock/dilution virions (and DIPs in
+// proportion to -d_pfu_initial/-v_pfu_initial) placed at random, and the plaques of
+// each well are counted at -readoutTime. titration.csv lists every well and
+// titration_summary.csv the mean plaques and PFU/particle ratio per dilution, pooled
+// over the dilutions whose mean plaque count lies in [1, -maxCountable].
+func runTitration(args []string) {
+	fs := flag.NewFlagSet("titrate", flag.ExitOnError)
+	stock := fs.Float64("stock", 1000, "Virions in the undiluted inoculum")
+	factor := fs.Float64("dilutionFactor", 10, "Fold dilution between steps of the series")
+	steps := fs.Int("dilutionSteps", 4, "Number of dilutions, starting from the undiluted stock")
+	replicates := fs.Int("replicates", 3, "Wells per dilution")
+	readoutTime := fs.Int("readoutTime", 72, "Time step at which plaques are counted")
+	maxCountable := fs.Float64("maxCountable", 20, "Largest mean plaque count per well used for the PFU/particle ratio")
+	flag.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	fs.Parse(args)
+	loadConfig(fs)
+	if *stock <= 0 || *factor <= 1 || *steps < 1 || *replicates < 1 || *readoutTime < 0 || *readoutTime >= TIME_STEPS {
+		log.Fatalf("titrate needs -stock > 0, -dilutionFactor > 1, -dilutionSteps >= 1, -replicates >= 1 and 0 <= -readoutTime < %d", TIME_STEPS)
+	}
+	dipsPerVirion := 0.0
+	if *flag_v_pfu_initial > 0 {
+		dipsPerVirion = *flag_d_pfu_initial / *flag_v_pfu_initial
+	}
+	simArgs := []string{"-option=3", "-initialCondition=", "-initialState=", "-plaqueTime=" + strconv.Itoa(*readoutTime)}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "stock", "dilutionFactor", "dilutionSteps", "replicates", "readoutTime", "maxCountable",
+			"v_pfu_initial", "d_pfu_initial", "plaqueTime", "option", "initialCondition", "initialState", "endTime":
+			return
+		}
+		simArgs = append(simArgs, forwardFlag(f))
+	})
+	// Plaques are counted at the readout, so each well runs exactly that far
+	simArgs = append(simArgs, "-endTime="+strconv.Itoa(*readoutTime))
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate the simulator: %v", err)
+	}
+	rand.Seed(time.Now().UnixNano())
+
+	root := fmt.Sprintf("%d_titrate_stock%s_F%s_R%d", getNextFolderNumber("./"),
+		strconv.FormatFloat(*stock, 'f', -1, 64), strconv.FormatFloat(*factor, 'f', -1, 64), *replicates)
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		log.Fatalf("Failed to create folder: %v", err)
+	}
+	wellFile, err := os.Create(filepath.Join(root, "titration.csv"))
+	if err != nil {
+		log.Fatalf("Failed to create titration CSV file: %v", err)
+	}
+	defer wellFile.Close()
+	wells := csv.NewWriter(wellFile)
+	defer wells.Flush()
+	wells.Write([]string{"dilution", "replicate", "virions", "DIPs", "plaques", "meanPlaqueSize", "runFolder"})
+
+	summaryFile, err := os.Create(filepath.Join(root, "titration_summary.csv"))
+	if err != nil {
+		log.Fatalf("Failed to create titration summary: %v", err)
+	}
+	defer summaryFile.Close()
+	summary := csv.NewWriter(summaryFile)
+	defer summary.Flush()
+	summary.Write([]string{"dilution", "meanVirions", "meanPlaques", "sdPlaques", "PFUperParticle", "countable"})
+
+	pooledPlaques, pooledParticles := 0, 0
+	for step := 0; step < *steps; step++ {
+		dilution := math.Pow(*factor, float64(step))
+		var plaques []float64
+		particles, total := 0, 0
+		for r := 1; r <= *replicates; r++ {
+			dir := filepath.Join(root, fmt.Sprintf("dil%s_rep%d", strconv.FormatFloat(dilution, 'f', -1, 64), r))
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				log.Fatalf("Failed to create folder: %v", err)
+			}
+			v := poissonSample(*stock / dilution)
+			d := poissonSample(float64(v) * dipsPerVirion)
+			logFile, err := os.Create(filepath.Join(dir, "run.log"))
+			if err != nil {
+				log.Fatalf("Failed to create run log: %v", err)
+			}
+			cmd := exec.Command(exe, append(simArgs, "-v_pfu_initial="+strconv.Itoa(v), "-d_pfu_initial="+strconv.Itoa(d))...)
+			cmd.Dir, cmd.Stdout, cmd.Stderr = dir, logFile, logFile
+			err = cmd.Run()
+			logFile.Close()
+			if err != nil {
+				log.Fatalf("Well %s failed (see %s): %v", dir, filepath.Join(dir, "run.log"), err)
+			}
+			runFolder, sizes := readPlaques(dir)
+			meanSize := 0.0
+			for _, size := range sizes {
+				meanSize += float64(size) / float64(len(sizes))
+			}
+			wells.Write([]string{strconv.FormatFloat(dilution, 'f', -1, 64), strconv.Itoa(r), strconv.Itoa(v), strconv.Itoa(d),
+				strconv.Itoa(len(sizes)), strconv.FormatFloat(meanSize, 'f', 2, 64), filepath.Join(filepath.Base(dir), runFolder)})
+			wells.Flush()
+			fmt.Printf("Dilution %g, well %d: %d virions, %d plaques\n", dilution, r, v, len(sizes))
+			plaques = append(plaques, float64(len(sizes)))
+			particles += v
+			total += len(sizes)
+		}
+
+		mean, sd := 0.0, 0.0
+		for _, p := range plaques {
+			mean += p / float64(len(plaques))
+		}
+		for _, p := range plaques {
+			sd += (p - mean) * (p - mean)
+		}
+		if len(plaques) > 1 {
+			sd = math.Sqrt(sd / float64(len(plaques)-1))
+		}
+		ratio := math.NaN()
+		if particles > 0 {
+			ratio = float64(total) / float64(particles)
+		}
+		countable := mean >= 1 && mean <= *maxCountable && particles > 0
+		if countable {
+			pooledPlaques += total
+			pooledParticles += particles
+		}
+		summary.Write([]string{strconv.FormatFloat(dilution, 'f', -1, 64),
+			strconv.FormatFloat(float64(particles)/float64(len(plaques)), 'f', 2, 64),
+			strconv.FormatFloat(mean, 'f', 2, 64), strconv.FormatFloat(sd, 'f', 2, 64),
+			strconv.FormatFloat(ratio, 'f', 6, 64), strconv.FormatBool(countable)})
+	}
+
+	pooled := math.NaN()
+	if pooledParticles > 0 {
+		pooled = float64(pooledPlaques) / float64(pooledParticles)
+	}
+	summary.Write([]string{"pooled", "", "", "", strconv.FormatFloat(pooled, 'f', 6, 64), ""})
+	fmt.Printf("PFU/particle ratio: %.4f (%d plaques from %d virions in countable wells); %.0f particles per PFU\n",
+		pooled, pooledPlaques, pooledParticles, 1/pooled)
+	log.Printf("Titration saved in %s\n", root)
+}
+
+// readPlaques returns the run folder a well wrote in dir and the plaque sizes in its
+// plaques.csv
+func readPlaques(dir string) (string, []int) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*", "plaques.csv"))
+	if err != nil || len(matches) != 1 {
+		log.Fatalf("Expected one plaques.csv in %s, found %d", dir, len(matches))
+	}
+	file, err := os.Open(matches[0])
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", matches[0], err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(records) < 1 {
+		log.Fatalf("Failed to read %s: %v", matches[0], err)
+	}
+	var sizes []int
+	for _, row := range records[1:] {
+		size, err := strconv.Atoi(row[2])
+		if err != nil {
+			log.Fatalf("Invalid plaque size %q in %s", row[2], matches[0])
+		}
+		sizes = append(sizes, size)
+	}
+	return filepath.Base(filepath.Dir(matches[0])), sizes
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "passage" {
+		runPassages(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "titrate" {
+		runTitration(os.Args[2:])
+		return
+	}
 	flag.Parse()
+	loadConfig(flag.CommandLine)
 	fmt.Printf("Parsed ifnSpreadOption: %q\n", *flag_ifnSpreadOption)
 	fmt.Printf("Parsed particleSpreadOption: %q\n", *flag_particleSpreadOption)
 
@@ -2998,8 +5661,6 @@ func main() {
 		// k_JumpR = 1.0
 		fmt.Println("flag main jump randomly")
 	} else if particleSpreadOption == "jumpradius" {
-		jumpRadiusV = 5
-		jumpRadiusD = 5
 		jumpRandomly = false
 		allowVirionJump = true
 		allowDIPJump = true
@@ -3017,10 +5678,66 @@ func main() {
 	} else {
 		log.Fatalf("Unknown particleSpreadOption: %s", particleSpreadOption)
 	}
+	boundaryCondition = *flag_boundary
+	if boundaryCondition != "absorbing" && boundaryCondition != "reflecting" && boundaryCondition != "periodic" {
+		log.Fatalf("Unknown boundary: %s", boundaryCondition)
+	}
+	loadWellMask(*flag_wellMask)
+	depositionPolicy = *flag_deposition
+	if depositionPolicy != "legacy" && depositionPolicy != "all" && depositionPolicy != "live" && depositionPolicy != "susceptible" {
+		log.Fatalf("Unknown deposition policy: %s", depositionPolicy)
+	}
+	debugMode = *flag_debug
+	intracellularModel = *flag_intracellular
+	wtReplicationRate = *flag_wtReplicationRate
+	dipSynthesisAdvantage = *flag_dipSynthesisAdvantage
+	genomeCapacity = *flag_genomeCapacity
+	if intracellularModel && (wtReplicationRate < 0 || dipSynthesisAdvantage < 0 || genomeCapacity <= 0) {
+		log.Fatalf("Intracellular model needs wtReplicationRate >= 0, dipSynthesisAdvantage >= 0 and genomeCapacity > 0")
+	}
+	particleUptake = *flag_particleUptake
+	legacyDIPBurst = *flag_legacyDIPBurst
+	if particleUptake != "none" && particleUptake != "infecting" && particleUptake != "all" {
+		log.Fatalf("Unknown particle uptake: %s", particleUptake)
+	}
+	releaseMode = *flag_releaseMode
+	if releaseMode != "burst" && releaseMode != "budding" && releaseMode != "mixed" {
+		log.Fatalf("Unknown release mode: %s", releaseMode)
+	}
+	buddingRate = *flag_buddingRate
+	eclipsePeriod = *flag_eclipsePeriod
+	if buddingRate < 0 || eclipsePeriod < 0 {
+		log.Fatalf("buddingRate and eclipsePeriod must be >= 0")
+	}
+
+	// Per-type spread settings default to -particleSpreadOption and -kJumpR
+	virionMode, dipMode := *flag_virionSpreadOption, *flag_dipSpreadOption
+	if virionMode == "" {
+		virionMode = particleSpreadOption
+	}
+	if dipMode == "" {
+		dipMode = particleSpreadOption
+	}
+	kJumpRV, kJumpRD := *flag_kJumpRV, *flag_kJumpRD
+	if kJumpRV < 0 {
+		kJumpRV = *flag_kJumpR
+	}
+	if kJumpRD < 0 {
+		kJumpRD = *flag_kJumpR
+	}
+	virionSpread = parseSpreadSettings(virionMode, *flag_jumpRadiusV, kJumpRV, *flag_virionKernel)
+	dipSpread = parseSpreadSettings(dipMode, *flag_jumpRadiusD, kJumpRD, *flag_dipKernel)
+	jumpRadiusV, jumpRadiusD = virionSpread.radius, dipSpread.radius
+	allowVirionJump = virionSpread.mode != "celltocell"
+	allowDIPJump = dipSpread.mode != "celltocell"
 	fmt.Println("\nParticle spread option settings:")
 	fmt.Printf("  particleSpreadOption: %s\n", particleSpreadOption)
-	fmt.Printf("  jumpRadiusV: %d, jumpRadiusD: %d, jumpRandomly: %v, k_JumpR: %.2f\n",
-		jumpRadiusV, jumpRadiusD, jumpRandomly, k_JumpR)
+	fmt.Printf("  jumpRadiusV: %d, jumpRadiusD: %d, jumpRandomly: %v, k_JumpR: %.2f, boundary: %s\n",
+		jumpRadiusV, jumpRadiusD, jumpRandomly, k_JumpR, boundaryCondition)
+	fmt.Printf("  wellMask: %q, cells in well: %d of %d\n", *flag_wellMask, len(realCells), GRID_SIZE*GRID_SIZE)
+	fmt.Printf("  virions: %s (radius %d, kJumpR %.2f, kernel %q), DIPs: %s (radius %d, kJumpR %.2f, kernel %q)\n",
+		virionSpread.mode, virionSpread.radius, virionSpread.kJumpR, *flag_virionKernel,
+		dipSpread.mode, dipSpread.radius, dipSpread.kJumpR, *flag_dipKernel)
 
 	// --- IFN Propagation Options ---
 	ifnSpreadOption = *flag_ifnSpreadOption
@@ -3053,6 +5770,84 @@ func main() {
 		fmt.Printf("ifnSpreadOption set to: %s, IFN_wave_radius: %d\n", ifnSpreadOption, IFN_wave_radius)
 
 	}
+	ifnSpeciesList = parseIFNSpecies(*flag_ifnSpecies)
+	if len(ifnSpeciesList) > 0 && ifnSpreadOption != "local" {
+		log.Fatalf("-ifnSpecies requires -ifnSpreadOption=local, got %s", ifnSpreadOption)
+	}
+	for _, s := range ifnSpeciesList {
+		fmt.Printf("  IFN species %s: radius %d, half-life %.2f, production V/D/both %.2f/%.2f/%.2f, potency %.2f\n",
+			s.name, s.radius, s.halfLife, s.prodV, s.prodD, s.prodBoth, s.potency)
+	}
+	ifnDoses = parseIFNDoses(*flag_ifnDose)
+	initialConditions = parseInitialConditions(*flag_initialCondition)
+	initialState = *flag_initialState
+	if *flag_snapshotTimes != "" {
+		for _, t := range strings.Split(*flag_snapshotTimes, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(t))
+			if err != nil || n < 0 || n >= TIME_STEPS {
+				log.Fatalf("Invalid snapshot time %q: want a time step in [0, %d)", t, TIME_STEPS)
+			}
+			snapshotTimes = append(snapshotTimes, n)
+		}
+	}
+	exoIFNHalfLife = *flag_exoIFNHalfLife
+	interventions = parseInterventions(*flag_interventions)
+	hasIFNBolus := false
+	for _, e := range interventions {
+		hasIFNBolus = hasIFNBolus || e.kind == "ifn"
+	}
+	antiviralTAU = TAU
+	if TAU == 0 && (len(ifnDoses) > 0 || hasIFNBolus) {
+		// Cells that cannot produce IFN (e.g. Vero) still respond to exogenous IFN
+		antiviralTAU = *flag_ifnResponseTau
+	}
+	for _, d := range ifnDoses {
+		fmt.Printf("  Exogenous IFN dose at t=%d: %.2f per cell\n", d.time, d.conc)
+	}
+	cellProfiles = parseCellProfiles(*flag_cellTypes)
+	strains = parseStrains(*flag_strains)
+	strainCoinfection = *flag_strainCoinfection
+	if strainCoinfection != "first" && strainCoinfection != "split" && strainCoinfection != "replace" {
+		log.Fatalf("Unknown strain co-infection rule: %s", strainCoinfection)
+	}
+	if videotype == "strains" && len(strains) == 0 {
+		log.Fatalf("-videotype=strains needs -strains")
+	}
+	for _, st := range strains {
+		fmt.Printf("  Strain %s: rho %.4f, burst %d, lysis %.2f, ifn %.2f, share %.2f\n", st.name, st.rho, st.burst, st.lysis, st.ifn, st.share)
+	}
+	lysisDelay = parseDelay("lysis", *flag_lysisTimeDist, MEAN_LYSIS_TIME, STANDARD_LYSIS_TIME)
+	antiviralDelay = parseDelay("antiviral", *flag_antiviralDelayDist, float64(antiviralTAU), float64(antiviralTAU)/4)
+	regrowthDelay = parseDelay("regrowth", *flag_regrowthTimeDist, REGROWTH_MEAN, REGROWTH_STD)
+	regrowthModel = *flag_regrowthModel
+	if regrowthModel != "delay" && regrowthModel != "proliferation" {
+		log.Fatalf("Unknown regrowth model: %s", regrowthModel)
+	}
+	proliferationRate = *flag_proliferationRate
+	if proliferationRate < 0 {
+		log.Fatalf("proliferationRate must be >= 0, got %v", proliferationRate)
+	}
+	regrowthInheritance = *flag_regrowthInherit
+	if regrowthInheritance != "none" && regrowthInheritance != "antiviral" {
+		log.Fatalf("Unknown regrowth inheritance: %s", regrowthInheritance)
+	}
+	superinfectionExclusion = *flag_superinfectionExclusion
+	plaqueTime = *flag_plaqueTime
+	minPlaqueSize = *flag_minPlaqueSize
+	if *flag_endTime < 0 || *flag_endTime >= TIME_STEPS {
+		log.Fatalf("endTime must be in [0, %d)", TIME_STEPS)
+	}
+	if plaqueTime >= TIME_STEPS || minPlaqueSize < 1 {
+		log.Fatalf("plaqueTime must be below %d and minPlaqueSize at least 1", TIME_STEPS)
+	}
+	dipOnlyFate = *flag_dipOnlyFate
+	if dipOnlyFate != "persist" && dipOnlyFate != "death" && dipOnlyFate != "recover" {
+		log.Fatalf("Unknown DIP-only fate: %s", dipOnlyFate)
+	}
+	dipFateDelay = parseDelay("dipOnlyFate", *flag_dipOnlyFateTimeDist, 48, 12)
+	if dipFateDelay.family == "legacy" {
+		log.Fatalf("-dipOnlyFateTimeDist has no legacy distribution")
+	}
 	fmt.Println("\nIFN spread option settings:")
 	fmt.Printf("  ifnSpreadOption: %s, IFN_wave_radius: %d, ifnBothFold: %.2f\n",
 		ifnSpreadOption, IFN_wave_radius, ifnBothFold)
@@ -3066,6 +5861,17 @@ func main() {
 		BURST_SIZE_D = 0
 		D_only_IFN_stimulate_ratio = 0.0
 	}
+	dipDeNovoRate = *flag_dipDeNovoRate
+	if dipDeNovoRate < 0 {
+		log.Fatalf("dipDeNovoRate must be >= 0, got %v", dipDeNovoRate)
+	}
+	dipVariants = parseDIPVariants(*flag_dipVariants, dipDeNovoRate > 0)
+	if len(dipVariants) > 0 && !dipOption {
+		log.Fatalf("-dipVariants and -dipDeNovoRate need -dipOption=true")
+	}
+	for _, v := range dipVariants {
+		fmt.Printf("  DIP variant %s: interference %.2f, advantage %.2f, share %.2f\n", v.name, v.interference, v.advantage, v.share)
+	}
 	fmt.Println("\nDIP option settings:")
 	fmt.Printf("  dipOption: %v, BURST_SIZE_D: %d, D_only_IFN_stimulate_ratio: %.2f, BOTH_IFN_stimulate_ratio: %.2f\n",
 		dipOption, BURST_SIZE_D, D_only_IFN_stimulate_ratio, BOTH_IFN_stimulate_ratio)
@@ -3082,8 +5888,13 @@ func main() {
 	} else {
 		R = 0
 	}
-	grid.initialize()                // Initialize the grid
-	grid.initializeNeighbors()       // Initialize the neighbors
+	grid.initialize()          // Initialize the grid
+	grid.initializeNeighbors() // Initialize the neighbors
+	grid.assignCellTypes(*flag_cellTypeLayout)
+	// Pretreatment: dose the uninfected well from the first exogenous IFN dose up to time 0
+	for t := firstIFNDoseTime(); t < 0; t++ {
+		grid.pretreat(t)
+	}
 	grid.initializeInfection(option) // Initialize the infection state
 
 	switch {
@@ -3169,6 +5980,8 @@ func main() {
 		log.Fatalf("Failed to create folder: %v", err)
 	}
 	saveCurrentGoFile(outputFolder)
+	saveRunConfig(outputFolder)
+	writeInitialConditions(outputFolder)
 	csvFilePath := filepath.Join(outputFolder, "simulation_output.csv")
 	videoFilePath := filepath.Join(outputFolder, "video.mp4")
 
@@ -3182,6 +5995,18 @@ func main() {
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
+	// Per-variant DIP totals over time, one row per variant and time step
+	if len(dipVariants) > 0 {
+		variantFile, err := os.Create(filepath.Join(outputFolder, "dip_variants.csv"))
+		if err != nil {
+			log.Fatalf("Failed to create DIP variant CSV file: %v", err)
+		}
+		defer variantFile.Close()
+		dipVariantWriter = csv.NewWriter(variantFile)
+		defer dipVariantWriter.Flush()
+		dipVariantWriter.Write([]string{"Time", "variant", "parent", "born", "interference", "advantage", "DIPs", "infectedCells"})
+	}
+
 	// Write the CSV headers
 	headers := []string{
 		"Time", "virion_half_life", "dip_half_life", "ifn_half_life", "Global IFN Concentration Per Cell", "Total Extracellular Virions",
@@ -3206,6 +6031,36 @@ func main() {
 		"ifnBothFold", "D_only_IFN_stimulate_ratio", "BOTH_IFN_stimulate_ratio",
 		"totalRandomJumpVirions", "totalRandomJumpDIPs", "dipAdvantage",
 	}
+	headers = append(headers, "Exogenous IFN Per Cell")
+	headers = append(headers, "boundary", "lostOffGridVirions", "lostOffGridDIPs")
+	headers = append(headers, "cellsInWell", "virionKernel", "dipKernel")
+	headers = append(headers, "virionSpreadOption", "dipSpreadOption", "kJumpRV", "kJumpRD")
+	headers = append(headers, "deposition", "particleUptake", "legacyDIPBurst")
+	headers = append(headers, "intracellular", "meanIntraWT", "meanIntraDVG")
+	headers = append(headers, "releaseMode", "buddingRate", "eclipsePeriod")
+	headers = append(headers, "dipOnlyFate", "dipOnlyDeaths", "dipOnlyRecoveries")
+	headers = append(headers, "superinfectionExclusion", "excludedFromCoinfection")
+	headers = append(headers, "regrowthModel", "proliferationRate", "regrowthInheritance")
+	headers = append(headers, "dipVariants", "dipDeNovoRate", "dipVariantCount", "dipVariantsAlive")
+	headers = append(headers, "drugRhoFactor", "drugBurstFactor")
+	// Cumulative particle ledgers; the off-grid losses are the lostOffGrid columns above
+	for _, p := range []string{"Virions", "DIPs"} {
+		headers = append(headers, "produced"+p, "deposited"+p, "decayed"+p, "lostRounding"+p, "lostBlocked"+p, "consumed"+p, "washed"+p)
+	}
+	for _, s := range ifnSpeciesList {
+		headers = append(headers, "IFN_"+s.name+"_total", "IFN_"+s.name+"_perCell")
+	}
+	for _, st := range strains {
+		headers = append(headers, "strain_"+st.name+"_virions", "strain_"+st.name+"_infected")
+	}
+	// Per-type cell counts by state when several cell types are simulated
+	if len(cellProfiles) > 1 {
+		for _, c := range cellProfiles {
+			for _, state := range []string{"susceptible", "infectedV", "dead", "antiviral", "regrowth", "infectedDIP", "infectedBoth"} {
+				headers = append(headers, "type_"+c.name+"_"+state)
+			}
+		}
+	}
 
 	err = writer.Write(headers)
 	if err != nil {
@@ -3235,12 +6090,18 @@ func main() {
 
 	var extractedImages []*image.RGBA // Store selected frame images
 
-	for frameNum := 0; frameNum < TIME_STEPS; frameNum++ {
+	for frameNum := 0; frameNum <= *flag_endTime; frameNum++ {
 
 		grid.update(frameNum) // Update the grid state
 
 		// Call the function to record infected state counts at the specific frames
 		grid.recordSimulationData(writer, frameNum)
+		if frameNum == plaqueTime {
+			grid.writePlaques(outputFolder, frameNum)
+		}
+		if contains(snapshotTimes, frameNum) {
+			grid.writeSnapshot(outputFolder, frameNum)
+		}
 
 		// Calculate and record the percentage of dead cells, excluding regrowth cells
 		deadCellsPercentage := calculateDeadCellPercentage(grid.state)
@@ -3248,9 +6109,9 @@ func main() {
 		deadCellPercentages = append(deadCellPercentages, deadCellsPercentage) // Record the percentage of dead cells
 
 		// Calculate infection percentages
-		virionOnly[frameNum] = float64(grid.calculateVirionOnlyInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
-		dipOnly[frameNum] = float64(grid.calculateDipOnlyInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
-		both[frameNum] = float64(grid.calculateBothInfected()) / float64(GRID_SIZE*GRID_SIZE) * 100
+		virionOnly[frameNum] = float64(grid.calculateVirionOnlyInfected()) / float64(len(realCells)) * 100
+		dipOnly[frameNum] = float64(grid.calculateDipOnlyInfected()) / float64(len(realCells)) * 100
+		both[frameNum] = float64(grid.calculateBothInfected()) / float64(len(realCells)) * 100
 
 		if frameNum > 1 {
 			if frameNum%24 == 0 { // Save every 10 frames
@@ -3307,6 +6168,8 @@ func main() {
 			savePNGImage(combinedImage, filepath.Join(outputFolder, "selected_frames_combined.png"))
 		}
 	}
+	writeDelaySummary(outputFolder)
+	writeInterventions(outputFolder)
 	log.Println("Video and graph saved successfully.") // Print a success message
 	fmt.Println("ifnWave is ", ifnWave)
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForwardFlagMakesFilePathsAbsolute(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("mask.png", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("wellMask", "mask.png", "")
+	fs.String("cellTypeLayout", "stripes:4", "")
+	fs.String("initialState", "", "")
+	abs, err := filepath.Abs("mask.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"wellMask":       "-wellMask=" + abs,
+		"cellTypeLayout": "-cellTypeLayout=stripes:4",
+		"initialState":   "-initialState=",
+	} {
+		if got := forwardFlag(fs.Lookup(name)); got != want {
+			t.Errorf("forwardFlag(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
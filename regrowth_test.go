@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProliferationFillsDeadSite(t *testing.T) {
+	defer func(rate float64, inheritance string) {
+		proliferationRate, regrowthInheritance = rate, inheritance
+	}(proliferationRate, regrowthInheritance)
+	proliferationRate = math.Inf(1)
+
+	for _, inheritance := range []string{"none", "antiviral"} {
+		regrowthInheritance = inheritance
+		g := newTestGrid(t, "absorbing")
+		g.initialize()
+		for _, nb := range g.neighbors1[10][10] {
+			g.state[nb[0]][nb[1]] = ANTIVIRAL
+		}
+		g.state[10][10] = DEAD
+		want := REGROWTH
+		if inheritance == "antiviral" {
+			want = ANTIVIRAL
+		}
+		// A second refill of the same site must not count it again
+		for refill := 0; refill < 2; refill++ {
+			newGrid := g.state
+			g.proliferate(10, 10, &newGrid)
+			if newGrid[10][10] != want {
+				t.Fatalf("%s inheritance: dead site became state %d, want %d", inheritance, newGrid[10][10], want)
+			}
+		}
+		wantCount := 0
+		if inheritance == "antiviral" {
+			wantCount = 1
+		}
+		if g.antiviralCellCount != wantCount {
+			t.Errorf("%s inheritance: %d antiviral cells counted, want %d", inheritance, g.antiviralCellCount, wantCount)
+		}
+	}
+}
+
+func TestProliferationNeedsLiveNeighbour(t *testing.T) {
+	defer func(rate float64) { proliferationRate = rate }(proliferationRate)
+	proliferationRate = math.Inf(1)
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	for _, nb := range g.neighbors1[10][10] {
+		g.state[nb[0]][nb[1]] = DEAD
+	}
+	g.state[10][10] = DEAD
+	newGrid := g.state
+	g.proliferate(10, 10, &newGrid)
+	if newGrid[10][10] != DEAD {
+		t.Errorf("site with no live neighbours became state %d", newGrid[10][10])
+	}
+}
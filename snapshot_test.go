@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	defer func(global float64) { globalIFN = global }(globalIFN)
+	dir := t.TempDir()
+	g := newTestGrid(t, "absorbing")
+	g.initialize()
+	g.state[3][4] = INFECTED_VIRION
+	g.state[5][6] = INFECTED_DIP
+	g.state[7][8] = INFECTED_BOTH
+	g.state[9][9] = DEAD
+	g.state[11][2] = ANTIVIRAL
+	g.state[12][3] = REGROWTH
+	g.localVirions[3][4], g.localDips[5][6] = 12, 7
+	g.IFNConcentration[11][2] = 0.25
+	g.writeSnapshot(dir, 5)
+
+	for _, ext := range []string{".csv", ".png"} {
+		loaded := newTestGrid(t, "absorbing")
+		loaded.initialize()
+		loaded.loadInitialState(filepath.Join(dir, "snapshot_t005"+ext))
+		if loaded.state != g.state {
+			t.Errorf("%s: loaded states differ from the saved grid", ext)
+		}
+		if ext != ".csv" {
+			continue
+		}
+		if loaded.localVirions != g.localVirions || loaded.localDips != g.localDips {
+			t.Errorf("%s: loaded particles differ from the saved grid", ext)
+		}
+		if loaded.IFNConcentration != g.IFNConcentration || globalIFN != 0.25 {
+			t.Errorf("%s: loaded IFN differs from the saved grid (global %v)", ext, globalIFN)
+		}
+		if loaded.antiviralCellCount != 1 {
+			t.Errorf("%s: %d antiviral cells counted, want 1", ext, loaded.antiviralCellCount)
+		}
+	}
+}
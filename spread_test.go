@@ -0,0 +1,173 @@
+package main
+
+import "testing"
+
+// Cells releasing the test bursts: the centre, an edge and a corner
+var burstOrigins = [][2]int{{GRID_SIZE / 2, GRID_SIZE / 2}, {0, GRID_SIZE / 2}, {0, 0}}
+
+// killNeighbours marks every other distance-1 neighbour of the burst origins dead
+func killNeighbours(g *Grid) {
+	for _, c := range burstOrigins {
+		for n, nb := range g.neighbors1[c[0]][c[1]] {
+			if n%2 == 0 && nb != [2]int{-1, -1} {
+				g.state[nb[0]][nb[1]] = DEAD
+			}
+		}
+	}
+}
+
+func TestSpreadParticlesConservesBursts(t *testing.T) {
+	defer func(policy string) { depositionPolicy = policy }(depositionPolicy)
+	settings := []spreadSettings{
+		{mode: "celltocell"},
+		{mode: "jumprandomly"},
+		{mode: "jumpradius", radius: 5},
+		{mode: "partition", kJumpR: 0.3},
+		{mode: "celltocell", kernel: parseKernel("gaussian:3")},
+		{mode: "celltocell", kernel: parseKernel("disc:4")},
+	}
+	for _, boundary := range []string{"absorbing", "reflecting", "periodic"} {
+		g := newTestGrid(t, boundary)
+		killNeighbours(g)
+		for _, policy := range []string{"legacy", "all", "live", "susceptible"} {
+			depositionPolicy = policy
+			for _, c := range burstOrigins {
+				ring := jumpDisc(c[0], c[1], 5)
+				for _, s := range settings {
+					for _, n := range []int{0, 1, 5, 97, 1000} {
+						var counts, strain [GRID_SIZE][GRID_SIZE]int
+						var ledger particleLedger
+						randomJumps := 0
+						g.spreadParticles(c[0], c[1], n, s, ring, &counts, &ledger, &randomJumps, &strain)
+						deposited := sumCounts(&counts)
+						if deposited != ledger.deposited {
+							t.Errorf("%s/%s, %s from %v: %d particles on the grid, ledger says %d", boundary, policy, s.mode, c, deposited, ledger.deposited)
+						}
+						if strain != counts {
+							t.Errorf("%s/%s, %s from %v: strain field differs from the counts", boundary, policy, s.mode, c)
+						}
+						if ledger.lostRounding != 0 {
+							t.Errorf("%s/%s, %s from %v: %d particles lost to rounding", boundary, policy, s.mode, c, ledger.lostRounding)
+						}
+						if policy != "legacy" && ledger.lostBlocked != 0 {
+							t.Errorf("%s/%s, %s from %v: %d particles blocked", boundary, policy, s.mode, c, ledger.lostBlocked)
+						}
+						if released := deposited + ledger.lostOffGrid + ledger.lostBlocked; released != n {
+							t.Errorf("%s/%s, %s from %v: released %d of %d particles (%+v)", boundary, policy, s.mode, c, released, n, ledger)
+						}
+						if boundary != "absorbing" && ledger.lostOffGrid != 0 {
+							t.Errorf("%s/%s, %s from %v: %d particles lost off a closed grid", boundary, policy, s.mode, c, ledger.lostOffGrid)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReleaseParticlesConservesBursts(t *testing.T) {
+	defer func(v, d spreadSettings, policy string) {
+		virionSpread, dipSpread, depositionPolicy = v, d, policy
+	}(virionSpread, dipSpread, depositionPolicy)
+	depositionPolicy = "legacy"
+	g := newTestGrid(t, "periodic")
+	for _, mode := range []string{"celltocell", "jumprandomly", "jumpradius", "partition"} {
+		virionSpread = spreadSettings{mode: mode, radius: 5, kJumpR: 0.3}
+		dipSpread = spreadSettings{mode: mode, radius: 5, kJumpR: 0.6}
+		for _, c := range burstOrigins {
+			g.localVirions, g.localDips = [GRID_SIZE][GRID_SIZE]int{}, [GRID_SIZE][GRID_SIZE]int{}
+			g.virionLedger, g.dipLedger = particleLedger{}, particleLedger{}
+			g.releaseParticles(c[0], c[1], 101, 37)
+			if v := g.totalVirions(); v != 101 || g.virionLedger.produced != 101 || g.virionLedger.deposited != 101 {
+				t.Errorf("%s from %v: %d of 101 virions deposited (%+v)", mode, c, v, g.virionLedger)
+			}
+			if d := g.totalDIPs(); d != 37 || g.dipLedger.produced != 37 || g.dipLedger.deposited != 37 {
+				t.Errorf("%s from %v: %d of 37 DIPs deposited (%+v)", mode, c, d, g.dipLedger)
+			}
+		}
+	}
+}
+
+func TestDispersalKernelsLandWithinReach(t *testing.T) {
+	newTestGrid(t, "periodic")
+	center := offsetToAxial(GRID_SIZE/2, GRID_SIZE/2)
+	for spec, reach := range map[string]int{"nearest": 1, "disc:3": 3} {
+		k := parseKernel(spec)
+		for n := 0; n < 2000; n++ {
+			i, j, ok := k.sample(GRID_SIZE/2, GRID_SIZE/2)
+			if !ok {
+				t.Fatalf("%s: particle lost on a periodic grid", spec)
+			}
+			if d := hexDistance(center, offsetToAxial(i, j)); d > reach || spec == "nearest" && d != 1 {
+				t.Fatalf("%s: particle landed at distance %d", spec, d)
+			}
+		}
+	}
+	// A Gaussian kernel keeps most particles within three standard deviations
+	k := parseKernel("gaussian:2")
+	near := 0
+	for n := 0; n < 2000; n++ {
+		if i, j, _ := k.sample(GRID_SIZE/2, GRID_SIZE/2); hexDistance(center, offsetToAxial(i, j)) <= 7 {
+			near++
+		}
+	}
+	if near < 1900 {
+		t.Errorf("gaussian:2 kept %d of 2000 particles within 7 cells", near)
+	}
+}
+
+func TestTakeUpParticles(t *testing.T) {
+	defer func(uptake string) { particleUptake = uptake }(particleUptake)
+	for _, c := range []struct {
+		uptake          string
+		byVirion, byDip bool
+		wantV, wantD    int
+	}{
+		{"none", true, true, 5, 3},
+		{"infecting", true, false, 4, 3},
+		{"infecting", true, true, 4, 2},
+		{"all", false, true, 0, 0},
+	} {
+		particleUptake = c.uptake
+		g := new(Grid)
+		g.localVirions[2][3], g.localDips[2][3] = 5, 3
+		g.takeUpParticles(2, 3, c.byVirion, c.byDip)
+		if g.localVirions[2][3] != c.wantV || g.localDips[2][3] != c.wantD {
+			t.Errorf("%s uptake left %d virions and %d DIPs, want %d and %d", c.uptake, g.localVirions[2][3], g.localDips[2][3], c.wantV, c.wantD)
+		}
+		if g.virionLedger.consumed != 5-c.wantV || g.dipLedger.consumed != 3-c.wantD {
+			t.Errorf("%s uptake recorded %d virions and %d DIPs consumed", c.uptake, g.virionLedger.consumed, g.dipLedger.consumed)
+		}
+	}
+}
+
+func TestLegacyDIPBurstIsOptIn(t *testing.T) {
+	defer func(v, d spreadSettings, legacy bool, burstD int, mode string) {
+		virionSpread, dipSpread, legacyDIPBurst, BURST_SIZE_D, releaseMode = v, d, legacy, burstD, mode
+	}(virionSpread, dipSpread, legacyDIPBurst, BURST_SIZE_D, releaseMode)
+	BURST_SIZE_D, releaseMode = 40, "burst"
+	g := newTestGrid(t, "periodic")
+	for _, c := range []struct {
+		mode          string
+		legacy        bool
+		virions, dips int
+		wantDIPs      int
+	}{
+		{"partition", false, 0, 0, 0},
+		{"partition", true, 0, 0, 40},
+		{"jumprandomly", false, 10, 10, 80},
+		{"jumprandomly", true, 10, 10, 160},
+		{"jumpradius", true, 0, 0, 0},
+	} {
+		legacyDIPBurst = c.legacy
+		virionSpread = spreadSettings{mode: c.mode, radius: 5, kJumpR: 0.5}
+		dipSpread = virionSpread
+		g.localVirions, g.localDips = [GRID_SIZE][GRID_SIZE]int{}, [GRID_SIZE][GRID_SIZE]int{}
+		g.localVirions[5][5], g.localDips[5][5] = c.virions, c.dips
+		g.dipLedger = particleLedger{}
+		g.releaseBurst(5, 5)
+		if got := g.dipLedger.produced; got != c.wantDIPs {
+			t.Errorf("%s, legacyDIPBurst=%v: %d DIPs released, want %d", c.mode, c.legacy, got, c.wantDIPs)
+		}
+	}
+}
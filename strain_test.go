@@ -0,0 +1,46 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseStrains(t *testing.T) {
+	list := parseStrains("wt:share=3; fast:burst=200,lysis=8,color=#00ff00")
+	if len(list) != 2 {
+		t.Fatalf("parsed %d strains, want 2", len(list))
+	}
+	if wt := list[0]; wt.name != "wt" || wt.share != 3 || wt.burst != BURST_SIZE_V || wt.rho != RHO {
+		t.Errorf("wt strain is %+v, want share 3 and the global burst and rho", wt)
+	}
+	if fast := list[1]; fast.burst != 200 || fast.lysis != 8 || fast.color != (color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("fast strain is %+v, want burst 200, lysis 8 and green", fast)
+	}
+}
+
+func TestStrainParametersFollowTheInfectingStrains(t *testing.T) {
+	defer func(list []virusStrain, profiles []cellProfile) {
+		strains, cellProfiles = list, profiles
+	}(strains, cellProfiles)
+	cellProfiles = []cellProfile{{name: "default", ifn: 2}}
+	strains = []virusStrain{{name: "a", burst: 100, ifn: 1}, {name: "b", burst: 300, ifn: 0.5}}
+
+	g := new(Grid)
+	if got := g.strainBurst(1, 1); got != BURST_SIZE_V {
+		t.Errorf("a cell without a strain bursts %d virions, want %d", got, BURST_SIZE_V)
+	}
+	g.strainMask[1][1] = 1 << 1
+	if got := g.strainBurst(1, 1); got != 300 {
+		t.Errorf("a cell infected by b bursts %d virions, want 300", got)
+	}
+	if got := g.ifnScale(1, 1); got != 1 {
+		t.Errorf("IFN scale of a b-infected cell is %v, want 2 * 0.5", got)
+	}
+	g.strainMask[1][1] = 1<<0 | 1<<1
+	if got := g.strainBurst(1, 1); got != 200 {
+		t.Errorf("a co-infected cell bursts %d virions, want the mean 200", got)
+	}
+	if got := g.ifnScale(1, 1); got != 1.5 {
+		t.Errorf("IFN scale of a co-infected cell is %v, want 2 * 0.75", got)
+	}
+}